@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Secret is a credential given in the config, in a file or in an environment
+// variable. Files and variables are read on every dial, so rotated
+// credentials are picked up without a reload. The value is never printed.
+type Secret struct {
+	Value string `yaml:"value,omitempty"`
+	File  string `yaml:"file,omitempty"`
+	Env   string `yaml:"env,omitempty"`
+}
+
+// isSet reports whether any source is configured.
+func (s Secret) isSet() bool {
+	return s.Value != "" || s.File != "" || s.Env != ""
+}
+
+// read returns the secret from its configured source. Surrounding whitespace
+// is trimmed from files, which usually end with a newline.
+func (s Secret) read() (string, error) {
+	switch {
+	case s.File != "":
+		content, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("error reading secret file: %w", err)
+		}
+		return strings.TrimSpace(string(content)), nil
+	case s.Env != "":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return value, nil
+	default:
+		return s.Value, nil
+	}
+}
+
+// validate checks that a single source is configured and can be read.
+func (s Secret) validate() error {
+	sources := 0
+	for _, source := range []string{s.Value, s.File, s.Env} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New("only one of value, file and env can be set")
+	}
+	_, err := s.read()
+	return err
+}
+
+// String keeps the secret out of formatted output.
+func (s Secret) String() string {
+	return "<secret>"
+}
+
+// MarshalYAML implements the yaml.Marshaler interface, hiding inline values.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if s.Value != "" {
+		s.Value = "<secret>"
+	}
+	type plain Secret
+	return plain(s), nil
+}
+
+// Auth configures the credentials sent with the WebSocket upgrade request.
+type Auth struct {
+	// Type is one of bearer, basic, api_key or jwt.
+	Type string `yaml:"type,omitempty"`
+	// Username and Password are used by basic.
+	Username string `yaml:"username,omitempty"`
+	Password Secret `yaml:"password,omitempty"`
+	// Token is used by bearer and api_key.
+	Token Secret `yaml:"token,omitempty"`
+	// Header carries the api_key token, X-API-Key by default.
+	Header string `yaml:"header,omitempty"`
+	// JWTSecret is the hex encoded 256-bit key shared with the server, as in
+	// the jwtsecret file of Ethereum execution clients. Used by jwt.
+	JWTSecret Secret `yaml:"jwt_secret,omitempty"`
+}
+
+// apply adds the credentials to the upgrade request headers.
+func (a Auth) apply(header http.Header) error {
+	switch a.Type {
+	case "bearer":
+		token, err := a.Token.read()
+		if err != nil {
+			return err
+		}
+		header.Set("Authorization", "Bearer "+token)
+	case "basic":
+		password, err := a.Password.read()
+		if err != nil {
+			return err
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + password))
+		header.Set("Authorization", "Basic "+credentials)
+	case "api_key":
+		token, err := a.Token.read()
+		if err != nil {
+			return err
+		}
+		name := a.Header
+		if name == "" {
+			name = "X-API-Key"
+		}
+		header.Set(name, token)
+	case "jwt":
+		token, err := a.jwtToken(time.Now())
+		if err != nil {
+			return err
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// jwtToken mints an HS256 token issued at now. The Engine API rejects tokens
+// whose iat is more than 60 seconds off, so a new one is minted for every
+// dial.
+func (a Auth) jwtToken(now time.Time) (string, error) {
+	key, err := a.jwtKey()
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{"iat": now.Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// jwtKey reads and decodes the JWT secret.
+func (a Auth) jwtKey() ([]byte, error) {
+	secret, err := a.JWTSecret.read()
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimPrefix(secret, "0x"))
+	if err != nil {
+		return nil, errors.New("JWT secret is not hex encoded")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("JWT secret must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// validate checks that the settings required by the auth type are present.
+func (a Auth) validate() error {
+	switch a.Type {
+	case "":
+		if a.Username != "" || a.Password.isSet() || a.Token.isSet() || a.Header != "" || a.JWTSecret.isSet() {
+			return errors.New("type is required")
+		}
+		return nil
+	case "bearer", "api_key":
+		if !a.Token.isSet() {
+			return fmt.Errorf("%s auth requires a token", a.Type)
+		}
+		if err := a.Token.validate(); err != nil {
+			return fmt.Errorf("invalid token: %w", err)
+		}
+	case "basic":
+		if a.Username == "" {
+			return errors.New("basic auth requires a username")
+		}
+		if err := a.Password.validate(); err != nil {
+			return fmt.Errorf("invalid password: %w", err)
+		}
+	case "jwt":
+		if !a.JWTSecret.isSet() {
+			return errors.New("jwt auth requires a jwt_secret")
+		}
+		if err := a.JWTSecret.validate(); err != nil {
+			return fmt.Errorf("invalid jwt_secret: %w", err)
+		}
+		if _, err := a.jwtKey(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown type %q", a.Type)
+	}
+	if a.Header != "" && a.Type != "api_key" {
+		return errors.New("header is only supported for api_key auth")
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gopkg.in/yaml.v3"
+)
+
+// TestProbeWebSocketAuth tests the credentials sent with the upgrade request
+func TestProbeWebSocketAuth(t *testing.T) {
+	url, lastHeader := newHeaderServer(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+	t.Setenv("TEST_WS_PASSWORD", "env-password")
+
+	testCases := []struct {
+		name     string
+		module   string
+		header   string
+		expected string
+	}{
+		{
+			name: "Static header",
+			module: `
+    websocket:
+      headers:
+        Origin: https://monitoring.example.com
+`,
+			header:   "Origin",
+			expected: "https://monitoring.example.com",
+		},
+		{
+			name: "Bearer token from file",
+			module: `
+    websocket:
+      auth:
+        type: bearer
+        token:
+          file: ` + tokenFile + `
+`,
+			header:   "Authorization",
+			expected: "Bearer file-token",
+		},
+		{
+			name: "Basic auth from environment",
+			module: `
+    websocket:
+      auth:
+        type: basic
+        username: monitoring
+        password:
+          env: TEST_WS_PASSWORD
+`,
+			header:   "Authorization",
+			expected: "Basic bW9uaXRvcmluZzplbnYtcGFzc3dvcmQ=",
+		},
+		{
+			name: "API key with default header",
+			module: `
+    websocket:
+      auth:
+        type: api_key
+        token:
+          value: inline-key
+`,
+			header:   "X-API-Key",
+			expected: "inline-key",
+		},
+		{
+			name: "API key with custom header",
+			module: `
+    websocket:
+      auth:
+        type: api_key
+        header: X-Provider-Key
+        token:
+          file: ` + tokenFile + `
+`,
+			header:   "X-Provider-Key",
+			expected: "file-token",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := probeWebSocket(context.Background(), url, "", loadModule(t, "    prober: websocket\n"+tc.module))
+			if !result.Success {
+				t.Fatal("probeWebSocket().Success = false, want true")
+			}
+			if got := lastHeader().Get(tc.header); got != tc.expected {
+				t.Errorf("%s header = %q, want %q", tc.header, got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestProbeWebSocketAuthRotation tests that secret files are read on every
+// dial and that an unreadable secret fails the probe
+func TestProbeWebSocketAuthRotation(t *testing.T) {
+	url, lastHeader := newHeaderServer(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+	module := loadModule(t, `
+    websocket:
+      auth:
+        type: bearer
+        token:
+          file: `+tokenFile+`
+`)
+
+	for _, token := range []string{"first", "second"} {
+		if err := os.WriteFile(tokenFile, []byte(token), 0o600); err != nil {
+			t.Fatalf("Failed to write token file: %v", err)
+		}
+		if result := probeWebSocket(context.Background(), url, "", module); !result.Success {
+			t.Fatal("probeWebSocket().Success = false, want true")
+		}
+		if got := lastHeader().Get("Authorization"); got != "Bearer "+token {
+			t.Errorf("Authorization header = %q, want %q", got, "Bearer "+token)
+		}
+	}
+
+	if err := os.Remove(tokenFile); err != nil {
+		t.Fatalf("Failed to remove token file: %v", err)
+	}
+	if result := probeWebSocket(context.Background(), url, "", module); result.Success || result.Up {
+		t.Error("probeWebSocket() with a missing token file should have failed before connecting")
+	}
+}
+
+// TestSecretNotPrinted tests that inline secrets are hidden when the config
+// is formatted or marshaled
+func TestSecretNotPrinted(t *testing.T) {
+	auth := Auth{Type: "bearer", Token: Secret{Value: "super-secret"}}
+
+	out, err := yaml.Marshal(auth)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() unexpected error: %v", err)
+	}
+	if strings.Contains(string(out), "super-secret") {
+		t.Errorf("marshaled auth contains the secret:\n%s", out)
+	}
+	if !strings.Contains(string(out), "<secret>") {
+		t.Errorf("marshaled auth does not mark the hidden secret:\n%s", out)
+	}
+
+	if formatted := auth.Token.String(); strings.Contains(formatted, "super-secret") {
+		t.Errorf("Secret.String() = %q, contains the secret", formatted)
+	}
+}
+
+// verifyJWT checks an HS256 token the way execution clients do and returns
+// its iat claim
+func verifyJWT(authorization string, key []byte) (int64, bool) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return 0, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return 0, false
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || string(header) != `{"alg":"HS256","typ":"JWT"}` {
+		return 0, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, false
+	}
+	var claims struct {
+		IssuedAt int64 `json:"iat"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return 0, false
+	}
+	return claims.IssuedAt, true
+}
+
+// TestProbeWebSocketJWTAuth tests the Engine API style JWT authentication
+func TestProbeWebSocketJWTAuth(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iat, ok := verifyJWT(r.Header.Get("Authorization"), key)
+		if !ok || time.Since(time.Unix(iat, 0)).Abs() > 60*time.Second {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dir := t.TempDir()
+	validSecret := filepath.Join(dir, "jwtsecret")
+	if err := os.WriteFile(validSecret, []byte("0x"+hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	otherSecret := filepath.Join(dir, "other")
+	if err := os.WriteFile(otherSecret, []byte(strings.Repeat("cd", 32)), 0o600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		secret   string
+		expected bool
+	}{
+		{name: "Matching secret", secret: validSecret, expected: true},
+		{name: "Wrong secret", secret: otherSecret, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module := loadModule(t, `
+    websocket:
+      auth:
+        type: jwt
+        jwt_secret:
+          file: `+tc.secret+`
+`)
+			if result := probeWebSocket(context.Background(), url, "", module); result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+		})
+	}
+}
+
+// TestJWTTokenIssuedAt tests that every token carries the time it was minted
+func TestJWTTokenIssuedAt(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	auth := Auth{Type: "jwt", JWTSecret: Secret{Value: hex.EncodeToString(key)}}
+
+	for _, issuedAt := range []time.Time{time.Unix(1700000000, 0), time.Unix(1700000061, 0)} {
+		token, err := auth.jwtToken(issuedAt)
+		if err != nil {
+			t.Fatalf("jwtToken() unexpected error: %v", err)
+		}
+		iat, ok := verifyJWT("Bearer "+token, key)
+		if !ok {
+			t.Fatalf("jwtToken() = %q, which does not verify", token)
+		}
+		if iat != issuedAt.Unix() {
+			t.Errorf("iat = %d, want %d", iat, issuedAt.Unix())
+		}
+	}
+}
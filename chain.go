@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// verifyChain asks the node which network it serves and fails the probe when
+// it does not match the module expectation. This catches providers that
+// silently route an endpoint to the wrong network.
+func verifyChain(ctx context.Context, c *probeConn, settings ChainVerification, result *probeResult) error {
+	client, err := newRPCClient(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	var observed string
+	switch settings.Type {
+	case "ethereum":
+		observed, err = ethereumChainID(client)
+	case "cosmos":
+		observed, err = cosmosChainID(client)
+	case "solana":
+		err = client.call("getGenesisHash", nil, &observed)
+	default:
+		err = fmt.Errorf("unknown chain type %q", settings.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching chain ID: %w", err)
+	}
+
+	match := observed == settings.normalizedChainID()
+	if match && settings.Type == "ethereum" && settings.NetVersion != "" {
+		var netVersion string
+		if err := client.call("net_version", nil, &netVersion); err != nil {
+			return fmt.Errorf("error fetching net_version: %w", err)
+		}
+		if netVersion != settings.NetVersion {
+			observed = fmt.Sprintf("%s/%s", observed, netVersion)
+			match = false
+		}
+	}
+
+	result.setInfo("probe_chain_info", "Chain ID reported by the node", prometheus.Labels{"chain_id": observed})
+	result.setGauge("probe_chain_id_match", "Whether the chain ID reported by the node matches the expected one", boolToFloat64(match))
+	if !match {
+		return assertionf("chain ID mismatch: expected %s, got %s", settings.ChainID, observed)
+	}
+	return nil
+}
+
+// ethereumChainID returns the eth_chainId of the node as a decimal string.
+func ethereumChainID(client *rpcClient) (string, error) {
+	var chainID string
+	if err := client.call("eth_chainId", nil, &chainID); err != nil {
+		return "", err
+	}
+	id, err := parseHexUint64(chainID)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(id, 10), nil
+}
+
+// cosmosChainID returns the network reported by the Tendermint status method.
+func cosmosChainID(client *rpcClient) (string, error) {
+	var status struct {
+		NodeInfo struct {
+			Network string `json:"network"`
+		} `json:"node_info"`
+	}
+	if err := client.call("status", nil, &status); err != nil {
+		return "", err
+	}
+	if status.NodeInfo.Network == "" {
+		return "", fmt.Errorf("status response has no network")
+	}
+	return status.NodeInfo.Network, nil
+}
+
+// normalizedChainID returns the expected chain ID in the form it is observed
+// in. Ethereum chain IDs may be configured in hex or decimal.
+func (v ChainVerification) normalizedChainID() string {
+	if v.Type == "ethereum" && strings.HasPrefix(v.ChainID, "0x") {
+		if id, err := parseHexUint64(v.ChainID); err == nil {
+			return strconv.FormatUint(id, 10)
+		}
+	}
+	return v.ChainID
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// chainHandler answers the chain identity methods of all supported chains
+func chainHandler(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+	switch method {
+	case "eth_chainId":
+		return "0x38", nil, nil
+	case "net_version":
+		return "56", nil, nil
+	case "status":
+		return map[string]interface{}{"node_info": map[string]string{"network": "cosmoshub-4"}}, nil, nil
+	case "getGenesisHash":
+		return "5eykt4UsFv8P8NJdTREpY1vzqKqZKvdpKuc147dw2N9d", nil, nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+}
+
+// TestVerifyChain tests the chain identity check for each chain type
+func TestVerifyChain(t *testing.T) {
+	url := newRPCServer(t, chainHandler)
+
+	testCases := []struct {
+		name            string
+		settings        ChainVerification
+		expected        bool
+		expectedChainID string
+	}{
+		{
+			name:            "Ethereum decimal chain ID",
+			settings:        ChainVerification{Type: "ethereum", ChainID: "56"},
+			expected:        true,
+			expectedChainID: "56",
+		},
+		{
+			name:            "Ethereum hex chain ID and net_version",
+			settings:        ChainVerification{Type: "ethereum", ChainID: "0x38", NetVersion: "56"},
+			expected:        true,
+			expectedChainID: "56",
+		},
+		{
+			name:            "Ethereum testnet expected",
+			settings:        ChainVerification{Type: "ethereum", ChainID: "97"},
+			expected:        false,
+			expectedChainID: "56",
+		},
+		{
+			name:            "Ethereum net_version mismatch",
+			settings:        ChainVerification{Type: "ethereum", ChainID: "56", NetVersion: "97"},
+			expected:        false,
+			expectedChainID: "56/56",
+		},
+		{
+			name:            "Cosmos network",
+			settings:        ChainVerification{Type: "cosmos", ChainID: "cosmoshub-4"},
+			expected:        true,
+			expectedChainID: "cosmoshub-4",
+		},
+		{
+			name:            "Solana genesis hash mismatch",
+			settings:        ChainVerification{Type: "solana", ChainID: "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG"},
+			expected:        false,
+			expectedChainID: "5eykt4UsFv8P8NJdTREpY1vzqKqZKvdpKuc147dw2N9d",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module := Module{Prober: "websocket", Timeout: time.Second, VerifyChain: tc.settings}
+			result := probeWebSocket(context.Background(), url, "", module)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if value, _ := resultGauge(t, result, "probe_chain_id_match"); value != boolToFloat64(tc.expected) {
+				t.Errorf("probe_chain_id_match = %v, want %v", value, boolToFloat64(tc.expected))
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(result.collectors()...)
+			expected := `
+# HELP probe_chain_info Chain ID reported by the node
+# TYPE probe_chain_info gauge
+probe_chain_info{chain_id="` + tc.expectedChainID + `"} 1
+`
+			if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "probe_chain_info"); err != nil {
+				t.Errorf("unexpected probe_chain_info: %v", err)
+			}
+		})
+	}
+}
+
+// TestVerifyChainRPCError tests that a node unable to report its chain fails the probe
+func TestVerifyChainRPCError(t *testing.T) {
+	url := newRPCServer(t, func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	})
+
+	module := Module{Prober: "websocket", Timeout: time.Second, VerifyChain: ChainVerification{Type: "solana", ChainID: "abc"}}
+	result := probeWebSocket(context.Background(), url, "", module)
+	if result.Success {
+		t.Errorf("probeWebSocket().Success = %v, want false", result.Success)
+	}
+	if _, ok := resultGauge(t, result, "probe_chain_id_match"); ok {
+		t.Error("probe_chain_id_match should not be exported when the chain ID is unknown")
+	}
+}
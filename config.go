@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultModuleName is the module used when a scrape does not pass the
+// `module` query parameter. It is always present, even without a config file.
+const defaultModuleName = "websocket"
+
+var (
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_exporter_config_last_reload_successful",
+		Help: "Whether the last configuration reload attempt was successful",
+	})
+
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration reload",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(configReloadSuccess)
+	prometheus.MustRegister(configReloadSeconds)
+}
+
+// Config is the exporter configuration loaded from --config.file.
+type Config struct {
+	Modules map[string]Module `yaml:"modules"`
+
+	// Redaction hides credentials embedded in target URLs from the logs.
+	Redaction Redaction `yaml:"redaction,omitempty"`
+}
+
+// Module describes how a target is probed. Modules are selected per scrape
+// with the `module` query parameter, mirroring the blackbox exporter.
+type Module struct {
+	Prober     string          `yaml:"prober,omitempty"`
+	Timeout    time.Duration   `yaml:"timeout,omitempty"`
+	WebSocket  WebSocketProbe  `yaml:"websocket,omitempty"`
+	Ethereum   EthereumProbe   `yaml:"ethereum,omitempty"`
+	Solana     SolanaProbe     `yaml:"solana,omitempty"`
+	Tendermint TendermintProbe `yaml:"tendermint,omitempty"`
+	Substrate  SubstrateProbe  `yaml:"substrate,omitempty"`
+	XRPL       XRPLProbe       `yaml:"xrpl,omitempty"`
+	Ogmios     OgmiosProbe     `yaml:"ogmios,omitempty"`
+	Script     ScriptProbe     `yaml:"script,omitempty"`
+
+	// VerifyChain checks the network served by the target before the
+	// prober runs.
+	VerifyChain ChainVerification `yaml:"verify_chain,omitempty"`
+
+	// Extract turns values of the received JSON messages into gauges.
+	Extract []ExtractRule `yaml:"extract,omitempty"`
+
+	// IgnoreRateLimits reports probes throttled by the target as successful
+	// instead of failed. probe_rate_limited is set either way.
+	IgnoreRateLimits bool `yaml:"ignore_rate_limits,omitempty"`
+}
+
+// WebSocketProbe holds the settings used to establish the WebSocket
+// connection and to check the first payload received on it.
+type WebSocketProbe struct {
+	Headers                map[string]string `yaml:"headers,omitempty"`
+	Auth                   Auth              `yaml:"auth,omitempty"`
+	Subprotocols           []string          `yaml:"subprotocols,omitempty"`
+	TLSConfig              TLSConfig         `yaml:"tls_config,omitempty"`
+	Query                  string            `yaml:"query,omitempty"`
+	FailIfMatchesRegexp    []Regexp          `yaml:"fail_if_matches_regexp,omitempty"`
+	FailIfNotMatchesRegexp []Regexp          `yaml:"fail_if_not_matches_regexp,omitempty"`
+	Ping                   PingSettings      `yaml:"ping,omitempty"`
+}
+
+// PingSettings configures the ping frames sent on the connection once the
+// prober checks passed, to measure the round trip of control frames.
+type PingSettings struct {
+	// Count is the number of pings sent. Pings are disabled when zero.
+	Count int `yaml:"count,omitempty"`
+	// Interval is the pause between a pong, or its timeout, and the next
+	// ping.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout bounds the wait for each pong, 1s by default. The remaining
+	// probe timeout applies when shorter.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// ExpectPong fails the probe when a pong is lost. Lost pongs are only
+	// counted otherwise, for endpoints that do not answer pings.
+	ExpectPong bool `yaml:"expect_pong,omitempty"`
+}
+
+// EthereumProbe holds the settings of the ethereum prober.
+type EthereumProbe struct {
+	// NewHeads subscribes to newHeads and waits for the first notification.
+	NewHeads bool `yaml:"new_heads,omitempty"`
+	// NewHeadsTimeout bounds the wait for the first head. The probe timeout
+	// applies when it is not set.
+	NewHeadsTimeout time.Duration `yaml:"new_heads_timeout,omitempty"`
+
+	// CheckSync queries eth_syncing and the latest block to export the sync
+	// status and head age. It is implied by the thresholds below.
+	CheckSync bool `yaml:"check_sync,omitempty"`
+	// FailIfSyncing fails the probe while the node reports it is syncing.
+	FailIfSyncing bool `yaml:"fail_if_syncing,omitempty"`
+	// MaxHeadAge fails the probe when the latest block is older than this.
+	MaxHeadAge time.Duration `yaml:"max_head_age,omitempty"`
+
+	// References are ws:// or wss:// endpoints whose head is fetched
+	// concurrently and compared with the head of the target.
+	References []string `yaml:"references,omitempty"`
+	// MaxLagBlocks fails the probe when the target is more than this many
+	// blocks behind the best reference.
+	MaxLagBlocks uint64 `yaml:"max_lag_blocks,omitempty"`
+}
+
+// checkSync reports whether the sync status checks should run.
+func (e EthereumProbe) checkSync() bool {
+	return e.CheckSync || e.FailIfSyncing || e.MaxHeadAge > 0
+}
+
+// SolanaProbe holds the settings of the solana prober.
+type SolanaProbe struct {
+	// RootSubscribe also subscribes to rootSubscribe and waits for the first
+	// root notification.
+	RootSubscribe bool `yaml:"root_subscribe,omitempty"`
+	// ObservationWindow keeps collecting slot notifications for this long
+	// after the first one to measure the slot advance rate.
+	ObservationWindow time.Duration `yaml:"observation_window,omitempty"`
+}
+
+// TendermintProbe holds the settings of the tendermint prober.
+type TendermintProbe struct {
+	// NewBlockTimeout bounds the wait for the first NewBlock event. The
+	// probe timeout applies when it is not set.
+	NewBlockTimeout time.Duration `yaml:"new_block_timeout,omitempty"`
+}
+
+// SubstrateProbe holds the settings of the substrate prober.
+type SubstrateProbe struct {
+	// FailIfSyncing fails the probe while system_health reports syncing.
+	FailIfSyncing bool `yaml:"fail_if_syncing,omitempty"`
+	// MinPeers fails the probe when the node has fewer peers. It is ignored
+	// for nodes that are not expected to have peers, such as dev chains.
+	MinPeers int `yaml:"min_peers,omitempty"`
+	// MaxFinalityGap fails the probe when the finalized head is more than
+	// this many blocks behind the best head.
+	MaxFinalityGap uint64 `yaml:"max_finality_gap,omitempty"`
+}
+
+// XRPLProbe holds the settings of the xrpl prober.
+type XRPLProbe struct {
+	// ValidServerStates fails the probe when server_info reports any other
+	// state, e.g. [full, validating, proposing].
+	ValidServerStates []string `yaml:"valid_server_states,omitempty"`
+	// LedgerTimeout bounds the wait for the first ledgerClosed message. The
+	// probe timeout applies when it is not set.
+	LedgerTimeout time.Duration `yaml:"ledger_timeout,omitempty"`
+}
+
+// OgmiosProbe holds the settings of the ogmios prober. The reference slot,
+// its start time and the slot length are used to compute the age of the tip
+// and default to Cardano mainnet since the Shelley hard fork.
+type OgmiosProbe struct {
+	ReferenceSlot uint64        `yaml:"reference_slot,omitempty"`
+	ReferenceTime time.Time     `yaml:"reference_time,omitempty"`
+	SlotLength    time.Duration `yaml:"slot_length,omitempty"`
+}
+
+// ScriptProbe holds the ordered steps of the script prober.
+type ScriptProbe struct {
+	Steps []ScriptStep `yaml:"steps,omitempty"`
+}
+
+// ScriptStep sends a frame, waits for an expected frame, or both.
+type ScriptStep struct {
+	// Name labels the step metrics and must be unique within the script.
+	Name string `yaml:"name"`
+	// Send is the frame sent by the step, rendered with the RequestID and
+	// Timestamp template values.
+	Send Template `yaml:"send,omitempty"`
+	// Binary sends the frame as a binary rather than a text message.
+	Binary bool `yaml:"binary,omitempty"`
+	// Expect describes the frame the step waits for.
+	Expect *ScriptExpect `yaml:"expect,omitempty"`
+}
+
+// ScriptExpect describes a frame a script step waits for.
+type ScriptExpect struct {
+	// Timeout bounds the wait for the frame. The remaining probe timeout
+	// applies when it is not set.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// SkipNonMatching ignores frames failing the assertions instead of
+	// failing the step, e.g. to skip unrelated subscription notifications.
+	SkipNonMatching bool                `yaml:"skip_non_matching,omitempty"`
+	Regexp          []Regexp            `yaml:"regexp,omitempty"`
+	JSONPath        []JSONPathAssertion `yaml:"jsonpath,omitempty"`
+}
+
+// JSONPathAssertion checks the value a JSONPath points at in a JSON frame.
+// Without equals or regexp, the path only has to exist.
+type JSONPathAssertion struct {
+	Path   JSONPath `yaml:"path"`
+	Equals Template `yaml:"equals,omitempty"`
+	Regexp Regexp   `yaml:"regexp,omitempty"`
+}
+
+// ExtractRule exports a value of the JSON messages received during the probe
+// as a gauge. When several messages match, the last one wins.
+type ExtractRule struct {
+	// Metric is the name of the exported gauge.
+	Metric string `yaml:"metric"`
+	Help   string `yaml:"help,omitempty"`
+	// Path points at the value in a received message.
+	Path JSONPath `yaml:"path"`
+	// ValueType is how the value is converted: number (the default, which
+	// also accepts numeric strings), hex for 0x-prefixed quantities or bool.
+	ValueType string `yaml:"value_type,omitempty"`
+	// Labels maps label names to paths of values in the same message.
+	Labels map[string]JSONPath `yaml:"labels,omitempty"`
+	// When restricts the rule to the messages passing all assertions, e.g.
+	// the response to a specific request ID.
+	When []JSONPathAssertion `yaml:"when,omitempty"`
+}
+
+// ChainVerification describes the network a target is expected to serve.
+type ChainVerification struct {
+	// Type is one of ethereum (eth_chainId), cosmos (status) or solana
+	// (getGenesisHash).
+	Type string `yaml:"type,omitempty"`
+	// ChainID is the expected chain ID, Cosmos network or Solana genesis hash.
+	ChainID string `yaml:"chain_id,omitempty"`
+	// NetVersion is the expected net_version of an Ethereum node.
+	NetVersion string `yaml:"net_version,omitempty"`
+}
+
+// TLSConfig configures the TLS client used for wss:// targets. The files are
+// read on every dial, so rotated certificates are picked up without a reload.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of the CAs trusted instead of the system ones.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile are the client certificate for mutual TLS.
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	// MinVersion and MaxVersion are one of TLS10, TLS11, TLS12 or TLS13.
+	MinVersion string `yaml:"min_version,omitempty"`
+	MaxVersion string `yaml:"max_version,omitempty"`
+}
+
+// Regexp is a regular expression that is compiled when the config is parsed.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// Template is a text/template that is parsed when the config is parsed.
+type Template struct {
+	*template.Template
+	raw string
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (t *Template) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid template %q: %w", s, err)
+	}
+	t.Template, t.raw = parsed, s
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (t Template) MarshalYAML() (interface{}, error) {
+	if t.Template == nil {
+		return nil, nil
+	}
+	return t.raw, nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (re *Regexp) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	compiled, err := regexp.Compile(s)
+	if err != nil {
+		return fmt.Errorf("invalid regexp %q: %w", s, err)
+	}
+	re.Regexp = compiled
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	if re.Regexp == nil {
+		return nil, nil
+	}
+	return re.String(), nil
+}
+
+// probeTimeout returns the module timeout, falling back to the --timeout flag.
+func (m Module) probeTimeout() time.Duration {
+	if m.Timeout > 0 {
+		return m.Timeout
+	}
+	return *timeout
+}
+
+// requestHeader builds the headers sent with the WebSocket upgrade request.
+// The credentials are read at this point, so that rotated ones are used.
+func (m Module) requestHeader() (http.Header, error) {
+	if len(m.WebSocket.Headers) == 0 && m.WebSocket.Auth.Type == "" {
+		return nil, nil
+	}
+	header := make(http.Header, len(m.WebSocket.Headers)+1)
+	for name, value := range m.WebSocket.Headers {
+		header.Set(name, value)
+	}
+	if err := m.WebSocket.Auth.apply(header); err != nil {
+		return nil, fmt.Errorf("error reading credentials: %w", err)
+	}
+	return header, nil
+}
+
+// validate checks a module for settings that cannot be expressed by the
+// YAML types alone.
+func (m Module) validate() error {
+	if _, ok := probers[m.Prober]; !ok {
+		return fmt.Errorf("unknown prober %q", m.Prober)
+	}
+	if m.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", m.Timeout)
+	}
+	if m.Ethereum.NewHeadsTimeout < 0 {
+		return fmt.Errorf("new_heads_timeout must not be negative, got %s", m.Ethereum.NewHeadsTimeout)
+	}
+	if m.Ethereum.MaxHeadAge < 0 {
+		return fmt.Errorf("max_head_age must not be negative, got %s", m.Ethereum.MaxHeadAge)
+	}
+	if m.Solana.ObservationWindow < 0 {
+		return fmt.Errorf("observation_window must not be negative, got %s", m.Solana.ObservationWindow)
+	}
+	if m.Solana.ObservationWindow >= m.probeTimeout() {
+		return fmt.Errorf("observation_window %s must be shorter than the timeout %s", m.Solana.ObservationWindow, m.probeTimeout())
+	}
+	if m.Tendermint.NewBlockTimeout < 0 {
+		return fmt.Errorf("new_block_timeout must not be negative, got %s", m.Tendermint.NewBlockTimeout)
+	}
+	if m.Substrate.MinPeers < 0 {
+		return fmt.Errorf("min_peers must not be negative, got %d", m.Substrate.MinPeers)
+	}
+	for _, state := range m.XRPL.ValidServerStates {
+		if !slices.Contains(xrplServerStates, state) {
+			return fmt.Errorf("unknown server state %q", state)
+		}
+	}
+	if m.XRPL.LedgerTimeout < 0 {
+		return fmt.Errorf("ledger_timeout must not be negative, got %s", m.XRPL.LedgerTimeout)
+	}
+	if m.Ogmios.SlotLength < 0 {
+		return fmt.Errorf("slot_length must not be negative, got %s", m.Ogmios.SlotLength)
+	}
+	if m.Ogmios.ReferenceSlot > 0 && m.Ogmios.ReferenceTime.IsZero() {
+		return errors.New("reference_slot requires reference_time")
+	}
+	if err := m.Script.validate(); err != nil {
+		return fmt.Errorf("invalid script: %w", err)
+	}
+	if m.Prober == "script" && len(m.Script.Steps) == 0 {
+		return errors.New("script prober requires at least one step")
+	}
+	for _, reference := range m.Ethereum.References {
+		referenceURL, err := url.Parse(reference)
+		if err != nil {
+			return fmt.Errorf("invalid reference %q: %w", reference, err)
+		}
+		if referenceURL.Scheme != "ws" && referenceURL.Scheme != "wss" {
+			return fmt.Errorf("invalid reference %q: scheme must be ws or wss", reference)
+		}
+	}
+	if m.Ethereum.MaxLagBlocks > 0 && len(m.Ethereum.References) == 0 {
+		return errors.New("max_lag_blocks requires at least one reference")
+	}
+	if err := m.VerifyChain.validate(); err != nil {
+		return fmt.Errorf("invalid verify_chain: %w", err)
+	}
+	if err := m.WebSocket.Auth.validate(); err != nil {
+		return fmt.Errorf("invalid auth: %w", err)
+	}
+	if err := m.WebSocket.TLSConfig.validate(); err != nil {
+		return fmt.Errorf("invalid tls_config: %w", err)
+	}
+	if err := m.WebSocket.Ping.validate(); err != nil {
+		return fmt.Errorf("invalid ping: %w", err)
+	}
+	for name := range m.WebSocket.Headers {
+		if name == "" {
+			return errors.New("header names must not be empty")
+		}
+	}
+	metrics := make(map[string]bool, len(m.Extract))
+	for _, rule := range m.Extract {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid extract rule for %q: %w", rule.Metric, err)
+		}
+		if metrics[rule.Metric] {
+			return fmt.Errorf("duplicate extract metric %q", rule.Metric)
+		}
+		metrics[rule.Metric] = true
+	}
+	return nil
+}
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// validate checks the metric and label names and the value type of a rule.
+func (r ExtractRule) validate() error {
+	if !metricNameRE.MatchString(r.Metric) {
+		return fmt.Errorf("invalid metric name %q", r.Metric)
+	}
+	// The probe_ namespace belongs to the exporter, and a clash would only
+	// show at scrape time when the series is dropped
+	if strings.HasPrefix(r.Metric, "probe_") {
+		return fmt.Errorf("metric name %q must not start with probe_, which is reserved for the exporter metrics", r.Metric)
+	}
+	if r.Path.String() == "" {
+		return errors.New("path is required")
+	}
+	switch r.ValueType {
+	case "", "number", "hex", "bool":
+	default:
+		return fmt.Errorf("unknown value_type %q", r.ValueType)
+	}
+	for name := range r.Labels {
+		if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// validate checks the script steps.
+func (s ScriptProbe) validate() error {
+	names := make(map[string]bool, len(s.Steps))
+	for i, step := range s.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("step %d has no name", i+1)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("duplicate step name %q", step.Name)
+		}
+		names[step.Name] = true
+		if step.Send.Template == nil && step.Expect == nil {
+			return fmt.Errorf("step %q has neither send nor expect", step.Name)
+		}
+		if step.Expect != nil && step.Expect.Timeout < 0 {
+			return fmt.Errorf("step %q: timeout must not be negative, got %s", step.Name, step.Expect.Timeout)
+		}
+	}
+	return nil
+}
+
+// validate checks the chain verification settings.
+func (v ChainVerification) validate() error {
+	switch v.Type {
+	case "":
+		if v.ChainID != "" || v.NetVersion != "" {
+			return errors.New("type is required")
+		}
+		return nil
+	case "ethereum", "cosmos", "solana":
+	default:
+		return fmt.Errorf("unknown type %q", v.Type)
+	}
+	if v.ChainID == "" {
+		return errors.New("chain_id is required")
+	}
+	if v.NetVersion != "" && v.Type != "ethereum" {
+		return errors.New("net_version is only supported for ethereum")
+	}
+	return nil
+}
+
+// defaultConfig returns the configuration used when no config file is given.
+func defaultConfig() *Config {
+	return &Config{
+		Modules: map[string]Module{
+			defaultModuleName: {Prober: "websocket"},
+		},
+	}
+}
+
+// loadConfig reads, parses and validates the config file at path.
+func loadConfig(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+
+	if cfg.Modules == nil {
+		cfg.Modules = map[string]Module{}
+	}
+	if _, ok := cfg.Modules[defaultModuleName]; !ok {
+		cfg.Modules[defaultModuleName] = Module{Prober: "websocket"}
+	}
+	for name, module := range cfg.Modules {
+		if module.Prober == "" {
+			module.Prober = "websocket"
+			cfg.Modules[name] = module
+		}
+		if err := module.validate(); err != nil {
+			return nil, fmt.Errorf("invalid module %q: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// SafeConfig guards the active configuration so it can be read by
+// concurrent probes.
+type SafeConfig struct {
+	sync.RWMutex
+	C *Config
+}
+
+// module looks up a module by name in the active configuration.
+func (sc *SafeConfig) module(name string) (Module, bool) {
+	sc.RLock()
+	defer sc.RUnlock()
+	module, ok := sc.C.Modules[name]
+	return module, ok
+}
+
+// config returns the active configuration.
+func (sc *SafeConfig) config() *Config {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.C
+}
+
+// redaction returns the redaction rules of the active configuration.
+func (sc *SafeConfig) redaction() Redaction {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.C.Redaction
+}
+
+// set replaces the active configuration.
+func (sc *SafeConfig) set(cfg *Config) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.C = cfg
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeConfig writes content to a temporary config file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+// TestLoadConfig tests parsing and validation of the modules config file
+func TestLoadConfig(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name: "Valid config",
+			content: `
+modules:
+  eth_newheads:
+    prober: websocket
+    timeout: 5s
+    ignore_rate_limits: true
+    websocket:
+      headers:
+        Origin: https://example.com
+      subprotocols: [json-rpc]
+      tls_config:
+        insecure_skip_verify: true
+      query: '{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}'
+      fail_if_not_matches_regexp: ['"result"']
+`,
+		},
+		{
+			name:    "Empty config",
+			content: "",
+		},
+		{
+			name: "Unknown prober",
+			content: `
+modules:
+  broken:
+    prober: carrier-pigeon
+`,
+			expectedErr: `invalid module "broken": unknown prober "carrier-pigeon"`,
+		},
+		{
+			name: "Negative timeout",
+			content: `
+modules:
+  broken:
+    timeout: -1s
+`,
+			expectedErr: "timeout must not be negative",
+		},
+		{
+			name: "Negative new heads timeout",
+			content: `
+modules:
+  broken:
+    prober: ethereum
+    ethereum:
+      new_heads: true
+      new_heads_timeout: -5s
+`,
+			expectedErr: "new_heads_timeout must not be negative",
+		},
+		{
+			name: "Chain verification without chain ID",
+			content: `
+modules:
+  broken:
+    verify_chain:
+      type: ethereum
+`,
+			expectedErr: "invalid verify_chain: chain_id is required",
+		},
+		{
+			name: "Chain verification with unknown type",
+			content: `
+modules:
+  broken:
+    verify_chain:
+      type: bitcoin
+      chain_id: main
+`,
+			expectedErr: `invalid verify_chain: unknown type "bitcoin"`,
+		},
+		{
+			name: "Reference with invalid scheme",
+			content: `
+modules:
+  broken:
+    prober: ethereum
+    ethereum:
+      references: [https://eth.example.com]
+`,
+			expectedErr: "scheme must be ws or wss",
+		},
+		{
+			name: "Max lag without references",
+			content: `
+modules:
+  broken:
+    prober: ethereum
+    ethereum:
+      max_lag_blocks: 5
+`,
+			expectedErr: "max_lag_blocks requires at least one reference",
+		},
+		{
+			name: "Observation window longer than timeout",
+			content: `
+modules:
+  broken:
+    prober: solana
+    timeout: 5s
+    solana:
+      observation_window: 10s
+`,
+			expectedErr: "observation_window 10s must be shorter than the timeout 5s",
+		},
+		{
+			name: "Unknown XRPL server state",
+			content: `
+modules:
+  broken:
+    prober: xrpl
+    xrpl:
+      valid_server_states: [fully]
+`,
+			expectedErr: `unknown server state "fully"`,
+		},
+		{
+			name: "Script without steps",
+			content: `
+modules:
+  broken:
+    prober: script
+`,
+			expectedErr: "script prober requires at least one step",
+		},
+		{
+			name: "Script with duplicate step names",
+			content: `
+modules:
+  broken:
+    prober: script
+    script:
+      steps:
+        - name: ping
+          send: ping
+        - name: ping
+          send: ping
+`,
+			expectedErr: `duplicate step name "ping"`,
+		},
+		{
+			name: "Script with invalid template",
+			content: `
+modules:
+  broken:
+    prober: script
+    script:
+      steps:
+        - name: ping
+          send: '{{ .RequestID'
+`,
+			expectedErr: "invalid template",
+		},
+		{
+			name: "Script with invalid JSONPath",
+			content: `
+modules:
+  broken:
+    prober: script
+    script:
+      steps:
+        - name: ping
+          expect:
+            jsonpath:
+              - path: result
+`,
+			expectedErr: "must start with $",
+		},
+		{
+			name: "Unknown auth type",
+			content: `
+modules:
+  broken:
+    websocket:
+      auth:
+        type: digest
+`,
+			expectedErr: `unknown type "digest"`,
+		},
+		{
+			name: "Bearer auth without token",
+			content: `
+modules:
+  broken:
+    websocket:
+      auth:
+        type: bearer
+`,
+			expectedErr: "bearer auth requires a token",
+		},
+		{
+			name: "Secret with several sources",
+			content: `
+modules:
+  broken:
+    websocket:
+      auth:
+        type: api_key
+        token:
+          value: key
+          env: API_KEY
+`,
+			expectedErr: "only one of value, file and env can be set",
+		},
+		{
+			name: "Secret from unset environment variable",
+			content: `
+modules:
+  broken:
+    websocket:
+      auth:
+        type: basic
+        username: monitoring
+        password:
+          env: WEBSOCKET_EXPORTER_TEST_UNSET
+`,
+			expectedErr: "environment variable WEBSOCKET_EXPORTER_TEST_UNSET is not set",
+		},
+		{
+			name: "JWT secret of the wrong length",
+			content: `
+modules:
+  broken:
+    websocket:
+      auth:
+        type: jwt
+        jwt_secret:
+          value: "0xabcd"
+`,
+			expectedErr: "JWT secret must be 32 bytes, got 2",
+		},
+		{
+			name: "Client certificate without key",
+			content: `
+modules:
+  broken:
+    websocket:
+      tls_config:
+        cert_file: client.pem
+`,
+			expectedErr: "cert_file and key_file must be set together",
+		},
+		{
+			name: "Unknown TLS version",
+			content: `
+modules:
+  broken:
+    websocket:
+      tls_config:
+        min_version: TLS14
+`,
+			expectedErr: `unknown TLS version "TLS14"`,
+		},
+		{
+			name: "TLS version range",
+			content: `
+modules:
+  broken:
+    websocket:
+      tls_config:
+        min_version: TLS13
+        max_version: TLS12
+`,
+			expectedErr: "min_version TLS13 is above max_version TLS12",
+		},
+		{
+			name: "Missing CA file",
+			content: `
+modules:
+  broken:
+    websocket:
+      tls_config:
+        ca_file: /nonexistent/ca.pem
+`,
+			expectedErr: "error reading CA file",
+		},
+		{
+			name: "Too many pings",
+			content: `
+modules:
+  broken:
+    websocket:
+      ping:
+        count: 1000
+`,
+			expectedErr: "count must be between 0 and 100",
+		},
+		{
+			name: "Expect pong without pings",
+			content: `
+modules:
+  broken:
+    websocket:
+      ping:
+        expect_pong: true
+`,
+			expectedErr: "expect_pong requires count to be set",
+		},
+		{
+			name: "Invalid extract metric name",
+			content: `
+modules:
+  broken:
+    extract:
+      - metric: peer-count
+        path: $.result
+`,
+			expectedErr: `invalid metric name "peer-count"`,
+		},
+		{
+			name: "Unknown extract value type",
+			content: `
+modules:
+  broken:
+    extract:
+      - metric: peer_count
+        path: $.result
+        value_type: float
+`,
+			expectedErr: `unknown value_type "float"`,
+		},
+		{
+			name: "Extract metric clashing with the exporter metrics",
+			content: `
+modules:
+  broken:
+    extract:
+      - metric: probe_success
+        path: $.result
+`,
+			expectedErr: `metric name "probe_success" must not start with probe_`,
+		},
+		{
+			name: "Duplicate extract metric",
+			content: `
+modules:
+  broken:
+    extract:
+      - metric: peer_count
+        path: $.result
+      - metric: peer_count
+        path: $.result.peers
+`,
+			expectedErr: `duplicate extract metric "peer_count"`,
+		},
+		{
+			name: "Invalid regexp",
+			content: `
+modules:
+  broken:
+    websocket:
+      fail_if_matches_regexp: ['(']
+`,
+			expectedErr: "invalid regexp",
+		},
+		{
+			name: "Unknown field",
+			content: `
+modules:
+  broken:
+    timeuot: 5s
+`,
+			expectedErr: "field timeuot not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := loadConfig(writeConfig(t, tc.content))
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("loadConfig() error = %v, want error containing %q", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig() unexpected error: %v", err)
+			}
+			if module, ok := cfg.Modules[defaultModuleName]; !ok || module.Prober != "websocket" {
+				t.Errorf("default module = %+v, %v, want websocket prober", module, ok)
+			}
+		})
+	}
+}
+
+// TestLoadConfigMissingFile tests that a missing config file is reported
+func TestLoadConfigMissingFile(t *testing.T) {
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("loadConfig() with missing file should have failed")
+	}
+}
+
+// TestModuleDefaults tests the defaults filled in for unset module fields
+func TestModuleDefaults(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, `
+modules:
+  fast:
+    timeout: 2s
+  plain: {}
+`))
+	if err != nil {
+		t.Fatalf("loadConfig() unexpected error: %v", err)
+	}
+
+	*timeout = 7 * time.Second
+	if got := cfg.Modules["fast"].probeTimeout(); got != 2*time.Second {
+		t.Errorf("fast.probeTimeout() = %v, want 2s", got)
+	}
+	if got := cfg.Modules["plain"].probeTimeout(); got != 7*time.Second {
+		t.Errorf("plain.probeTimeout() = %v, want 7s", got)
+	}
+	if got := cfg.Modules["plain"].Prober; got != "websocket" {
+		t.Errorf("plain.Prober = %q, want websocket", got)
+	}
+}
+
+// TestProbeHandlerModule tests module selection through the query string
+func TestProbeHandlerModule(t *testing.T) {
+	origConfig := safeConfig.C
+	defer safeConfig.set(origConfig)
+
+	cfg, err := loadConfig(writeConfig(t, `
+modules:
+  with_headers:
+    timeout: 2s
+    websocket:
+      headers:
+        X-Probe: exporter
+`))
+	if err != nil {
+		t.Fatalf("loadConfig() unexpected error: %v", err)
+	}
+	safeConfig.set(cfg)
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Probe") != "exporter" {
+			http.Error(w, "missing header", http.StatusForbidden)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	testCases := []struct {
+		name           string
+		module         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Module with headers",
+			module:         "with_headers",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "probe_success 1",
+		},
+		{
+			name:           "Default module",
+			module:         "",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "probe_success 0",
+		},
+		{
+			name:           "Unknown module",
+			module:         "does_not_exist",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `Unknown module "does_not_exist"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/probe?target="+wsURL+"&module="+tc.module, nil)
+			rr := httptest.NewRecorder()
+			probeHandler(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tc.expectedBody) {
+				t.Errorf("response missing %q:\n%s", tc.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestProbeWebSocketPayloadChecks tests the query and regexp checks run after the handshake
+func TestProbeWebSocketPayloadChecks(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"echo"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				t.Logf("Failed to close connection: %v", err)
+			}
+		}()
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(messageType, message); err != nil {
+			t.Logf("Failed to echo message: %v", err)
+		}
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	mustRegexp := func(s string) Regexp {
+		return Regexp{regexp.MustCompile(s)}
+	}
+
+	testCases := []struct {
+		name     string
+		settings WebSocketProbe
+		expected bool
+	}{
+		{
+			name:     "Matching response",
+			settings: WebSocketProbe{Subprotocols: []string{"echo"}, Query: "hello", FailIfNotMatchesRegexp: []Regexp{mustRegexp("^hel")}},
+			expected: true,
+		},
+		{
+			name:     "Response not matching",
+			settings: WebSocketProbe{Query: "hello", FailIfNotMatchesRegexp: []Regexp{mustRegexp("^bye")}},
+			expected: false,
+		},
+		{
+			name:     "Response matching forbidden regexp",
+			settings: WebSocketProbe{Query: "error", FailIfMatchesRegexp: []Regexp{mustRegexp("error")}},
+			expected: false,
+		},
+		{
+			name:     "No response before timeout",
+			settings: WebSocketProbe{FailIfNotMatchesRegexp: []Regexp{mustRegexp(".")}},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module := Module{Prober: "websocket", Timeout: 500 * time.Millisecond, WebSocket: tc.settings}
+			result := probeWebSocket(context.Background(), wsURL, "", module)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if !result.Up {
+				t.Errorf("result.Up = %v, want true", result.Up)
+			}
+		})
+	}
+}
+
+// TestReloadHandler tests the /-/reload endpoint
+func TestReloadHandler(t *testing.T) {
+	origConfig := safeConfig.C
+	origConfigFile := *configFile
+	defer func() {
+		safeConfig.set(origConfig)
+		*configFile = origConfigFile
+	}()
+
+	*configFile = writeConfig(t, `
+modules:
+  reloaded:
+    timeout: 1s
+`)
+
+	testCases := []struct {
+		name           string
+		method         string
+		expectedStatus int
+	}{
+		{
+			name:           "GET is rejected",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "POST reloads",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			reloadHandler(rr, httptest.NewRequest(tc.method, "/-/reload", nil))
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+		})
+	}
+
+	if _, ok := safeConfig.module("reloaded"); !ok {
+		t.Error("module reloaded missing after POST /-/reload")
+	}
+
+	if err := os.WriteFile(*configFile, []byte("modules: ["), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	reloadHandler(rr, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if _, ok := safeConfig.module("reloaded"); !ok {
+		t.Error("previous config was not kept after a failed POST /-/reload")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// probeEthereum checks that the node behind the WebSocket gateway answers
+// JSON-RPC requests by asking for the latest block number.
+func probeEthereum(ctx context.Context, c *probeConn, module Module, result *probeResult) error {
+	client, err := newRPCClient(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	// Fetch the reference heads while the target is being queried
+	var references <-chan uint64
+	if len(module.Ethereum.References) > 0 {
+		references = fetchReferenceHeads(ctx, module)
+	}
+
+	var blockNumber string
+	requestStart := time.Now()
+	if err := client.call("eth_blockNumber", nil, &blockNumber); err != nil {
+		return err
+	}
+	result.setGauge("probe_eth_request_duration_seconds", "Round-trip time of the eth_blockNumber request", time.Since(requestStart).Seconds())
+
+	number, err := parseHexUint64(blockNumber)
+	if err != nil {
+		return fmt.Errorf("invalid block number: %w", err)
+	}
+	result.setGauge("probe_eth_block_number", "Latest block number reported by eth_blockNumber", float64(number))
+
+	if references != nil {
+		if err := checkHeadLag(number, references, module.Ethereum, result); err != nil {
+			return err
+		}
+	}
+
+	if module.Ethereum.checkSync() {
+		if err := probeEthereumSync(client, module.Ethereum, result); err != nil {
+			return err
+		}
+	}
+
+	if module.Ethereum.NewHeads {
+		return probeEthereumNewHeads(client, module.Ethereum, result)
+	}
+	return nil
+}
+
+// probeEthereumSync checks that the node is neither syncing nor stuck on an
+// old head. A connectable node far behind the chain is worse than one that is
+// down, since clients keep using it.
+func probeEthereumSync(client *rpcClient, settings EthereumProbe, result *probeResult) error {
+	// eth_syncing returns false, or an object describing the sync progress
+	var syncing json.RawMessage
+	if err := client.call("eth_syncing", nil, &syncing); err != nil {
+		return err
+	}
+	isSyncing := string(syncing) != "false"
+	result.setGauge("probe_node_syncing", "Whether the node reports that it is syncing", boolToFloat64(isSyncing))
+
+	var block ethereumHead
+	if err := client.call("eth_getBlockByNumber", []interface{}{"latest", false}, &block); err != nil {
+		return err
+	}
+	timestamp, err := parseHexUint64(block.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid latest block timestamp: %w", err)
+	}
+	headAge := time.Since(time.Unix(int64(timestamp), 0))
+	result.setGauge("probe_head_age_seconds", "Age of the latest block based on its timestamp", headAge.Seconds())
+
+	if settings.FailIfSyncing && isSyncing {
+		return assertionf("node is syncing")
+	}
+	if settings.MaxHeadAge > 0 && headAge > settings.MaxHeadAge {
+		return assertionf("latest block is %s old, more than the allowed %s", headAge.Round(time.Second), settings.MaxHeadAge)
+	}
+	return nil
+}
+
+// ethereumHead is the part of a block header the prober looks at.
+type ethereumHead struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+// probeEthereumNewHeads subscribes to newHeads and waits for the first head,
+// which is what dApps relying on subscriptions actually depend on.
+func probeEthereumNewHeads(client *rpcClient, settings EthereumProbe, result *probeResult) error {
+	subscribeStart := time.Now()
+	subscription, err := client.subscribe("eth_subscribe", []string{"newHeads"})
+	if err != nil {
+		return err
+	}
+	ackTime := time.Now()
+	result.setGauge("probe_eth_subscription_ack_duration_seconds", "Time until the eth_subscribe request was acknowledged with a subscription ID", ackTime.Sub(subscribeStart).Seconds())
+
+	if settings.NewHeadsTimeout > 0 {
+		if err := client.setReadTimeout(settings.NewHeadsTimeout); err != nil {
+			return err
+		}
+	}
+
+	var head ethereumHead
+	if err := client.nextSubscriptionResult(subscription, &head); err != nil {
+		return fmt.Errorf("no newHeads notification received: %w", err)
+	}
+	result.setGauge("probe_eth_first_head_duration_seconds", "Time from the subscription acknowledgement to the first newHeads notification", time.Since(ackTime).Seconds())
+
+	number, err := parseHexUint64(head.Number)
+	if err != nil {
+		return fmt.Errorf("invalid head number: %w", err)
+	}
+	result.setGauge("probe_eth_head_block_number", "Block number of the first newHeads notification", float64(number))
+
+	timestamp, err := parseHexUint64(head.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid head timestamp: %w", err)
+	}
+	result.setGauge("probe_eth_head_age_seconds", "Age of the first newHeads notification based on its block timestamp", time.Since(time.Unix(int64(timestamp), 0)).Seconds())
+	return nil
+}
+
+// fetchReferenceHeads fetches the block number of every reference endpoint
+// concurrently. The channel yields the heads of the references that answered
+// and is closed once all of them are done.
+func fetchReferenceHeads(ctx context.Context, module Module) <-chan uint64 {
+	heads := make(chan uint64, len(module.Ethereum.References))
+	var wg sync.WaitGroup
+	for _, reference := range module.Ethereum.References {
+		wg.Add(1)
+		go func(reference string) {
+			defer wg.Done()
+			head, err := referenceHead(ctx, reference, module)
+			if err != nil {
+				fmt.Printf("Failed to fetch head of reference %s: %v\n", redactTarget(reference), err)
+				return
+			}
+			heads <- head
+		}(reference)
+	}
+	go func() {
+		wg.Wait()
+		close(heads)
+	}()
+	return heads
+}
+
+// referenceModule returns the module used to dial reference endpoints. The
+// headers, auth and client certificate belong to the target and must not
+// reach other providers; the server name only applies to the target.
+func (m Module) referenceModule() Module {
+	m.WebSocket.Headers = nil
+	m.WebSocket.Auth = Auth{}
+	m.WebSocket.TLSConfig.ServerName = ""
+	m.WebSocket.TLSConfig.CertFile = ""
+	m.WebSocket.TLSConfig.KeyFile = ""
+	return m
+}
+
+// referenceHead returns the latest block number of a reference endpoint,
+// dialed with the TLS settings and deadline of the target, but without its
+// credentials.
+func referenceHead(ctx context.Context, reference string, module Module) (uint64, error) {
+	c, _, err := dial(ctx, reference, module.referenceModule())
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := c.Close(); err != nil {
+			fmt.Printf("Error closing reference connection: %v\n", err)
+		}
+	}()
+
+	client, err := newRPCClient(ctx, &probeConn{Conn: c})
+	if err != nil {
+		return 0, err
+	}
+	var blockNumber string
+	if err := client.call("eth_blockNumber", nil, &blockNumber); err != nil {
+		return 0, err
+	}
+	return parseHexUint64(blockNumber)
+}
+
+// checkHeadLag compares the head of the target with the best reference head.
+// References that cannot be reached do not fail the probe, since the target
+// is not at fault.
+func checkHeadLag(head uint64, references <-chan uint64, settings EthereumProbe, result *probeResult) error {
+	var best uint64
+	found := false
+	for reference := range references {
+		if !found || reference > best {
+			best = reference
+		}
+		found = true
+	}
+	if !found {
+		fmt.Printf("No reference endpoint answered, skipping head lag check\n")
+		return nil
+	}
+
+	lag := float64(best) - float64(head)
+	result.setGauge("probe_reference_head_block_number", "Highest block number reported by the reference endpoints", float64(best))
+	result.setGauge("probe_head_lag_blocks", "Number of blocks the target is behind the best reference endpoint", lag)
+
+	if settings.MaxLagBlocks > 0 && lag > float64(settings.MaxLagBlocks) {
+		return assertionf("target is %.0f blocks behind the reference, more than the allowed %d", lag, settings.MaxLagBlocks)
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newHeaderServer starts a mock WebSocket server that records the headers of
+// the last upgrade request
+func newHeaderServer(t *testing.T) (string, func() http.Header) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		last http.Header
+	)
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		last = r.Header.Clone()
+		mu.Unlock()
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http"), func() http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+// TestProbeEthereum tests the eth_blockNumber check run after the handshake
+func TestProbeEthereum(t *testing.T) {
+	testCases := []struct {
+		name          string
+		handler       rpcHandler
+		expected      bool
+		expectedBlock float64
+	}{
+		{
+			name: "Healthy node",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				return "0x1b4", nil, nil
+			},
+			expected:      true,
+			expectedBlock: 436,
+		},
+		{
+			name: "JSON-RPC error",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				return nil, &rpcError{Code: -32000, Message: "backend unavailable"}, nil
+			},
+			expected: false,
+		},
+		{
+			name: "Invalid block number",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				return "latest", nil, nil
+			},
+			expected: false,
+		},
+		{
+			name: "Backend never answers",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				return nil, nil, nil
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := newRPCServer(t, tc.handler)
+			module := Module{Prober: "ethereum", Timeout: 500 * time.Millisecond}
+
+			result := probeWebSocket(context.Background(), url, "", module)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if !result.Up {
+				t.Errorf("result.Up = %v, want true", result.Up)
+			}
+
+			if !tc.expected {
+				return
+			}
+			if value, _ := resultGauge(t, result, "probe_eth_block_number"); value != tc.expectedBlock {
+				t.Errorf("probe_eth_block_number = %v, want %v", value, tc.expectedBlock)
+			}
+			if value, ok := resultGauge(t, result, "probe_eth_request_duration_seconds"); !ok || value <= 0 {
+				t.Errorf("probe_eth_request_duration_seconds = %v, want > 0", value)
+			}
+		})
+	}
+}
+
+// ethereumNewHeadsHandler answers eth_blockNumber and eth_subscribe, sending
+// the given notifications right after the subscription acknowledgement
+func ethereumNewHeadsHandler(notifications ...interface{}) rpcHandler {
+	return func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		switch method {
+		case "eth_blockNumber":
+			return "0x10", nil, nil
+		case "eth_subscribe":
+			return "0xabc", nil, notifications
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	}
+}
+
+// ethereumHeadNotification builds a newHeads notification for subscription
+func ethereumHeadNotification(subscription string, number uint64, timestamp time.Time) interface{} {
+	return rpcNotification("eth_subscription", map[string]interface{}{
+		"subscription": subscription,
+		"result": map[string]string{
+			"number":    "0x" + strconv.FormatUint(number, 16),
+			"timestamp": "0x" + strconv.FormatInt(timestamp.Unix(), 16),
+		},
+	})
+}
+
+// TestProbeEthereumNewHeads tests the newHeads subscription check
+func TestProbeEthereumNewHeads(t *testing.T) {
+	headTime := time.Now().Add(-5 * time.Second)
+
+	testCases := []struct {
+		name         string
+		handler      rpcHandler
+		expected     bool
+		expectedHead float64
+	}{
+		{
+			name:         "Head received",
+			handler:      ethereumNewHeadsHandler(ethereumHeadNotification("0xabc", 17, headTime)),
+			expected:     true,
+			expectedHead: 17,
+		},
+		{
+			name: "Other subscriptions are ignored",
+			handler: ethereumNewHeadsHandler(
+				ethereumHeadNotification("0xdef", 99, headTime),
+				ethereumHeadNotification("0xabc", 18, headTime),
+			),
+			expected:     true,
+			expectedHead: 18,
+		},
+		{
+			name:     "No head before the max wait",
+			handler:  ethereumNewHeadsHandler(),
+			expected: false,
+		},
+		{
+			name: "Subscriptions not supported",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				if method == "eth_blockNumber" {
+					return "0x10", nil, nil
+				}
+				return nil, &rpcError{Code: -32601, Message: "notifications not supported"}, nil
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := newRPCServer(t, tc.handler)
+			module := Module{
+				Prober:   "ethereum",
+				Timeout:  2 * time.Second,
+				Ethereum: EthereumProbe{NewHeads: true, NewHeadsTimeout: 200 * time.Millisecond},
+			}
+
+			start := time.Now()
+			result := probeWebSocket(context.Background(), url, "", module)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("probe took %v, want the max wait to bound it", elapsed)
+			}
+
+			if !tc.expected {
+				return
+			}
+			if value, _ := resultGauge(t, result, "probe_eth_head_block_number"); value != tc.expectedHead {
+				t.Errorf("probe_eth_head_block_number = %v, want %v", value, tc.expectedHead)
+			}
+			if value, _ := resultGauge(t, result, "probe_eth_head_age_seconds"); value < 4 || value > 10 {
+				t.Errorf("probe_eth_head_age_seconds = %v, want about 5", value)
+			}
+			for _, name := range []string{"probe_eth_subscription_ack_duration_seconds", "probe_eth_first_head_duration_seconds"} {
+				if value, ok := resultGauge(t, result, name); !ok || value <= 0 {
+					t.Errorf("%s = %v, want > 0", name, value)
+				}
+			}
+		})
+	}
+}
+
+// ethereumSyncHandler answers the sync status methods with the given state
+func ethereumSyncHandler(syncing interface{}, headTime time.Time) rpcHandler {
+	return func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		switch method {
+		case "eth_blockNumber":
+			return "0x10", nil, nil
+		case "eth_syncing":
+			return syncing, nil, nil
+		case "eth_getBlockByNumber":
+			return map[string]string{"number": "0x10", "timestamp": "0x" + strconv.FormatInt(headTime.Unix(), 16)}, nil, nil
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	}
+}
+
+// TestProbeEthereumSync tests the sync status and head freshness checks
+func TestProbeEthereumSync(t *testing.T) {
+	syncProgress := map[string]string{"startingBlock": "0x0", "currentBlock": "0x10", "highestBlock": "0x200"}
+
+	testCases := []struct {
+		name            string
+		handler         rpcHandler
+		settings        EthereumProbe
+		expected        bool
+		expectedSyncing float64
+	}{
+		{
+			name:            "Synced node with fresh head",
+			handler:         ethereumSyncHandler(false, time.Now().Add(-3*time.Second)),
+			settings:        EthereumProbe{FailIfSyncing: true, MaxHeadAge: time.Minute},
+			expected:        true,
+			expectedSyncing: 0,
+		},
+		{
+			name:            "Syncing node",
+			handler:         ethereumSyncHandler(syncProgress, time.Now()),
+			settings:        EthereumProbe{FailIfSyncing: true},
+			expected:        false,
+			expectedSyncing: 1,
+		},
+		{
+			name:            "Syncing node only reported",
+			handler:         ethereumSyncHandler(syncProgress, time.Now()),
+			settings:        EthereumProbe{CheckSync: true},
+			expected:        true,
+			expectedSyncing: 1,
+		},
+		{
+			name:            "Stale head",
+			handler:         ethereumSyncHandler(false, time.Now().Add(-10*time.Minute)),
+			settings:        EthereumProbe{MaxHeadAge: time.Minute},
+			expected:        false,
+			expectedSyncing: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := newRPCServer(t, tc.handler)
+			module := Module{Prober: "ethereum", Timeout: time.Second, Ethereum: tc.settings}
+
+			result := probeWebSocket(context.Background(), url, "", module)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if value, _ := resultGauge(t, result, "probe_node_syncing"); value != tc.expectedSyncing {
+				t.Errorf("probe_node_syncing = %v, want %v", value, tc.expectedSyncing)
+			}
+			if value, ok := resultGauge(t, result, "probe_head_age_seconds"); !ok || value < 0 {
+				t.Errorf("probe_head_age_seconds = %v, want >= 0", value)
+			}
+		})
+	}
+}
+
+// blockNumberHandler answers eth_blockNumber with a fixed block number
+func blockNumberHandler(number uint64) rpcHandler {
+	return func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		return "0x" + strconv.FormatUint(number, 16), nil, nil
+	}
+}
+
+// TestProbeEthereumHeadLag tests the comparison against reference endpoints
+func TestProbeEthereumHeadLag(t *testing.T) {
+	target := newRPCServer(t, blockNumberHandler(100))
+	behind := newRPCServer(t, blockNumberHandler(90))
+	ahead := newRPCServer(t, blockNumberHandler(105))
+	farAhead := newRPCServer(t, blockNumberHandler(200))
+	unreachable := "ws://127.0.0.1:1"
+
+	testCases := []struct {
+		name        string
+		references  []string
+		maxLag      uint64
+		expected    bool
+		expectedLag float64
+		expectLag   bool
+	}{
+		{
+			name:        "Best reference is used",
+			references:  []string{behind, ahead},
+			maxLag:      10,
+			expected:    true,
+			expectedLag: 5,
+			expectLag:   true,
+		},
+		{
+			name:        "Target ahead of reference",
+			references:  []string{behind},
+			maxLag:      10,
+			expected:    true,
+			expectedLag: -10,
+			expectLag:   true,
+		},
+		{
+			name:        "Lag above threshold",
+			references:  []string{ahead, farAhead},
+			maxLag:      10,
+			expected:    false,
+			expectedLag: 100,
+			expectLag:   true,
+		},
+		{
+			name:        "Unreachable reference is skipped",
+			references:  []string{unreachable, ahead},
+			maxLag:      10,
+			expected:    true,
+			expectedLag: 5,
+			expectLag:   true,
+		},
+		{
+			name:       "No reference answered",
+			references: []string{unreachable},
+			maxLag:     10,
+			expected:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module := Module{
+				Prober:   "ethereum",
+				Timeout:  time.Second,
+				Ethereum: EthereumProbe{References: tc.references, MaxLagBlocks: tc.maxLag},
+			}
+
+			result := probeWebSocket(context.Background(), target, "", module)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			value, ok := resultGauge(t, result, "probe_head_lag_blocks")
+			if ok != tc.expectLag {
+				t.Fatalf("probe_head_lag_blocks exported = %v, want %v", ok, tc.expectLag)
+			}
+			if ok && value != tc.expectedLag {
+				t.Errorf("probe_head_lag_blocks = %v, want %v", value, tc.expectedLag)
+			}
+		})
+	}
+}
+
+// TestProbeEthereumReferenceCredentials tests that the credentials of the
+// target are not sent to the reference endpoints
+func TestProbeEthereumReferenceCredentials(t *testing.T) {
+	target := newRPCServer(t, blockNumberHandler(100))
+	reference, lastHeader := newHeaderServer(t)
+
+	module := Module{
+		Prober:   "ethereum",
+		Timeout:  time.Second,
+		Ethereum: EthereumProbe{References: []string{reference}, MaxLagBlocks: 10},
+	}
+	module.WebSocket.Headers = map[string]string{"X-Api-Key": "target-secret"}
+	module.WebSocket.Auth = Auth{Type: "bearer", Token: Secret{Value: "target-token"}}
+
+	probeWebSocket(context.Background(), target, "", module)
+
+	header := lastHeader()
+	if header == nil {
+		t.Fatal("reference endpoint was not dialed")
+	}
+	for _, name := range []string{"X-Api-Key", "Authorization"} {
+		if value := header.Get(name); value != "" {
+			t.Errorf("reference received %s header %q", name, value)
+		}
+	}
+}
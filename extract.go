@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// extractMetrics applies the module extraction rules to the messages received
+// during the probe. Every rule is reported in probe_extract_failed, so that a
+// rule that stopped matching does not go unnoticed.
+func extractMetrics(messages [][]byte, rules []ExtractRule, result *probeResult) {
+	documents := make([]interface{}, 0, len(messages))
+	for _, message := range messages {
+		var document interface{}
+		if err := json.Unmarshal(message, &document); err != nil {
+			continue
+		}
+		documents = append(documents, document)
+	}
+
+	for _, rule := range rules {
+		err := extractRule(documents, rule, result)
+		if err != nil {
+			fmt.Printf("Extraction of %s failed: %v\n", rule.Metric, err)
+		}
+		result.setLabeledGauge("probe_extract_failed", "Whether the extraction rule for the metric failed", prometheus.Labels{"metric": rule.Metric}, boolToFloat64(err != nil))
+	}
+}
+
+// extractRule exports one series per distinct label set found in the
+// documents, keeping the value of the last matching document.
+func extractRule(documents []interface{}, rule ExtractRule, result *probeResult) error {
+	type series struct {
+		labels prometheus.Labels
+		value  float64
+	}
+	var (
+		extracted []series
+		index     = make(map[string]int)
+		lastErr   error
+	)
+
+	for _, document := range documents {
+		if !matchesAll(document, rule.When) {
+			continue
+		}
+		raw, err := rule.Path.lookup(document)
+		if err != nil {
+			continue
+		}
+		value, err := extractValue(raw, rule.ValueType)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", rule.Path, err)
+			continue
+		}
+		labels, err := extractLabels(document, rule.Labels)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		key := labelsKey(labels)
+		if i, ok := index[key]; ok {
+			extracted[i].value = value
+			continue
+		}
+		index[key] = len(extracted)
+		extracted = append(extracted, series{labels: labels, value: value})
+	}
+
+	help := rule.Help
+	if help == "" {
+		help = fmt.Sprintf("Value extracted from %s", rule.Path)
+	}
+	for _, s := range extracted {
+		result.setLabeledGauge(rule.Metric, help, s.labels, s.value)
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	if len(extracted) == 0 {
+		return fmt.Errorf("%s not found in any received message", rule.Path)
+	}
+	return nil
+}
+
+// matchesAll reports whether the document passes all assertions.
+func matchesAll(document interface{}, assertions []JSONPathAssertion) bool {
+	for _, assertion := range assertions {
+		if err := assertion.check(document, scriptData{}); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// extractValue converts a JSON value to a sample value.
+func extractValue(value interface{}, valueType string) (float64, error) {
+	if valueType == "" {
+		valueType = "number"
+	}
+	switch valueType {
+	case "number":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case "hex":
+		if s, ok := value.(string); ok {
+			number, err := parseHexUint64(s)
+			return float64(number), err
+		}
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return boolToFloat64(b), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot convert %s to a %s value", jsonValueString(value), valueType)
+}
+
+// extractLabels looks up the label values of a rule in the document.
+func extractLabels(document interface{}, paths map[string]JSONPath) (prometheus.Labels, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	labels := make(prometheus.Labels, len(paths))
+	for name, path := range paths {
+		value, err := path.lookup(document)
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", name, err)
+		}
+		labels[name] = jsonValueString(value)
+	}
+	return labels, nil
+}
+
+// labelsKey returns a string identifying a label set.
+func labelsKey(labels prometheus.Labels) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"\xff"+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\xff")
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestExtractMetrics tests the conversion of received messages into gauges
+func TestExtractMetrics(t *testing.T) {
+	messages := [][]byte{
+		[]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1a"}`),
+		[]byte(`{"jsonrpc":"2.0","id":2,"result":{"peers":12,"syncing":false,"queue":"7.5"}}`),
+		[]byte(`not json`),
+		[]byte(`{"method":"queue","params":{"name":"blocks","depth":3}}`),
+		[]byte(`{"method":"queue","params":{"name":"txs","depth":40}}`),
+		[]byte(`{"method":"queue","params":{"name":"blocks","depth":5}}`),
+	}
+
+	testCases := []struct {
+		name           string
+		rule           string
+		expected       string
+		expectedFailed bool
+	}{
+		{
+			name: "Number",
+			rule: `
+      - metric: peer_count
+        help: Number of peers
+        path: $.result.peers
+`,
+			expected: `
+# HELP peer_count Number of peers
+# TYPE peer_count gauge
+peer_count 12
+`,
+		},
+		{
+			name: "Numeric string",
+			rule: `
+      - metric: queue_depth
+        path: $.result.queue
+`,
+			expected: `
+# HELP queue_depth Value extracted from $.result.queue
+# TYPE queue_depth gauge
+queue_depth 7.5
+`,
+		},
+		{
+			name: "Hex quantity filtered by ID",
+			rule: `
+      - metric: gas_price_wei
+        path: $.result
+        value_type: hex
+        when:
+          - path: $.id
+            equals: "1"
+`,
+			expected: `
+# HELP gas_price_wei Value extracted from $.result
+# TYPE gas_price_wei gauge
+gas_price_wei 26
+`,
+		},
+		{
+			name: "Bool",
+			rule: `
+      - metric: node_syncing
+        path: $.result.syncing
+        value_type: bool
+`,
+			expected: `
+# HELP node_syncing Value extracted from $.result.syncing
+# TYPE node_syncing gauge
+node_syncing 0
+`,
+		},
+		{
+			name: "Labels keep the last value per series",
+			rule: `
+      - metric: queue_depth
+        path: $.params.depth
+        labels:
+          queue: $.params.name
+`,
+			expected: `
+# HELP queue_depth Value extracted from $.params.depth
+# TYPE queue_depth gauge
+queue_depth{queue="blocks"} 5
+queue_depth{queue="txs"} 40
+`,
+		},
+		{
+			name: "Path not found",
+			rule: `
+      - metric: missing
+        path: $.result.missing
+`,
+			expectedFailed: true,
+		},
+		{
+			name: "Value not convertible",
+			rule: `
+      - metric: peer_count
+        path: $.result
+        when:
+          - path: $.id
+            equals: "2"
+`,
+			expectedFailed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module := loadModule(t, "    extract:"+tc.rule)
+			var result probeResult
+			extractMetrics(messages, module.Extract, &result)
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(result.Extra...)
+			metric := module.Extract[0].Metric
+			if err := testutil.GatherAndCompare(registry, strings.NewReader(tc.expected), metric); err != nil {
+				t.Errorf("unexpected %s: %v", metric, err)
+			}
+
+			failed := "0"
+			if tc.expectedFailed {
+				failed = "1"
+			}
+			expectedFailed := `
+# HELP probe_extract_failed Whether the extraction rule for the metric failed
+# TYPE probe_extract_failed gauge
+probe_extract_failed{metric="` + metric + `"} ` + failed + "\n"
+			if err := testutil.GatherAndCompare(registry, strings.NewReader(expectedFailed), "probe_extract_failed"); err != nil {
+				t.Errorf("unexpected probe_extract_failed: %v", err)
+			}
+		})
+	}
+}
+
+// TestProbeWebSocketExtract tests that extraction runs on the messages read
+// by the prober, including when the probe fails
+func TestProbeWebSocketExtract(t *testing.T) {
+	url := newRPCServer(t, func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		switch method {
+		case "eth_blockNumber":
+			return "0x10", nil, nil
+		case "eth_syncing":
+			return map[string]string{"currentBlock": "0x10", "highestBlock": "0x20"}, nil, nil
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	})
+
+	module := loadModule(t, `
+    prober: ethereum
+    timeout: 2s
+    ethereum:
+      fail_if_syncing: true
+    extract:
+      - metric: eth_highest_block
+        path: $.result.highestBlock
+        value_type: hex
+`)
+	result := probeWebSocket(context.Background(), url, "", module)
+	if result.Success {
+		t.Error("probeWebSocket().Success = true, want false")
+	}
+
+	if value, ok := resultGauge(t, result, "eth_highest_block"); !ok || value != 32 {
+		t.Errorf("eth_highest_block = %v (found %v), want 32", value, ok)
+	}
+	if value, ok := resultGauge(t, result, "probe_extract_failed"); !ok || value != 0 {
+		t.Errorf("probe_extract_failed = %v (found %v), want 0", value, ok)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// failureReasons are the values of the reason label of probe_failed_due_to.
+var failureReasons = []string{
+	"invalid_url",
+	"invalid_scheme",
+	"config",
+	"dns",
+	"connection_refused",
+	"tls",
+	"http_status",
+	"timeout",
+	"connection",
+	"protocol",
+	"assertion",
+	"rate_limited",
+}
+
+// errModuleConfig marks errors caused by the module settings rather than the
+// target, such as an unreadable CA file or secret.
+var errModuleConfig = errors.New("invalid module settings")
+
+// assertionError reports a check the target failed, as opposed to an error
+// talking to it.
+type assertionError struct {
+	msg string
+}
+
+func (e *assertionError) Error() string {
+	return e.msg
+}
+
+// assertionf formats an assertionError.
+func assertionf(format string, args ...interface{}) error {
+	return &assertionError{msg: fmt.Sprintf(format, args...)}
+}
+
+// failureReason classifies err into one of failureReasons. Errors that match
+// none of the known causes are reported as fallback, which depends on the
+// phase of the probe the error happened in.
+func failureReason(err error, fallback string) string {
+	var (
+		dnsErr       *net.DNSError
+		rpcErr       *rpcError
+		assertionErr *assertionError
+		netErr       net.Error
+	)
+	switch {
+	case errors.Is(err, errModuleConfig):
+		return "config"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case isTLSError(err):
+		return "tls"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "timeout"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &rpcErr):
+		return "protocol"
+	case errors.As(err, &assertionErr):
+		return "assertion"
+	}
+	return fallback
+}
+
+// isTLSError reports whether err comes from the TLS handshake or the
+// verification of the server certificate.
+func isTLSError(err error) bool {
+	var (
+		verificationErr *tls.CertificateVerificationError
+		recordErr       tls.RecordHeaderError
+		alertErr        tls.AlertError
+		authorityErr    x509.UnknownAuthorityError
+		hostnameErr     x509.HostnameError
+		invalidErr      x509.CertificateInvalidError
+	)
+	if errors.As(err, &verificationErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return true
+	}
+	// The remaining handshake errors are not typed
+	return strings.HasPrefix(err.Error(), "tls: ")
+}
+
+// failureCollectors renders probe_failed_due_to with one series per reason,
+// set to 1 for the reason the probe failed and 0 for the others.
+func failureCollectors(reason string) []prometheus.Collector {
+	collectors := make([]prometheus.Collector, 0, len(failureReasons))
+	for _, r := range failureReasons {
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "probe_failed_due_to",
+			Help:        "Indicates the reason the probe failed",
+			ConstLabels: prometheus.Labels{"reason": r},
+		})
+		if r == reason {
+			gauge.Set(1)
+		}
+		collectors = append(collectors, gauge)
+	}
+	return collectors
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestFailureReason tests the classification of probe errors
+func TestFailureReason(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		fallback string
+		expected string
+	}{
+		{
+			name:     "Module settings",
+			err:      fmt.Errorf("%w: %w", errModuleConfig, os.ErrNotExist),
+			fallback: "connection",
+			expected: "config",
+		},
+		{
+			name:     "DNS failure",
+			err:      &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "node.invalid", IsNotFound: true}},
+			fallback: "connection",
+			expected: "dns",
+		},
+		{
+			name:     "Connection refused",
+			err:      &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			fallback: "connection",
+			expected: "connection_refused",
+		},
+		{
+			name:     "Unknown certificate authority",
+			err:      &net.OpError{Op: "remote error", Err: x509.UnknownAuthorityError{}},
+			fallback: "connection",
+			expected: "tls",
+		},
+		{
+			name:     "Untyped TLS error",
+			err:      errors.New("tls: server selected unsupported protocol version 301"),
+			fallback: "connection",
+			expected: "tls",
+		},
+		{
+			name:     "Deadline exceeded",
+			err:      fmt.Errorf("error reading message: %w", context.DeadlineExceeded),
+			fallback: "protocol",
+			expected: "timeout",
+		},
+		{
+			name:     "Read timeout",
+			err:      &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded},
+			fallback: "protocol",
+			expected: "timeout",
+		},
+		{
+			name:     "JSON-RPC error",
+			err:      fmt.Errorf("error fetching chain ID: %w", &rpcError{Code: -32601, Message: "method not found"}),
+			fallback: "protocol",
+			expected: "protocol",
+		},
+		{
+			name:     "Assertion",
+			err:      fmt.Errorf("step %q failed: %w", "subscribe", assertionf("frame did not match regexp %q", "ok")),
+			fallback: "protocol",
+			expected: "assertion",
+		},
+		{
+			name:     "Unknown error",
+			err:      errors.New("unexpected EOF"),
+			fallback: "protocol",
+			expected: "protocol",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := failureReason(tc.err, tc.fallback); got != tc.expected {
+				t.Errorf("failureReason(%v) = %q, want %q", tc.err, got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestProbeWebSocketFailedDueTo tests the failure reason and status code
+// exported for probes failing at each stage
+func TestProbeWebSocketFailedDueTo(t *testing.T) {
+	healthy := "ws" + strings.TrimPrefix(newDelayedServer(t, 0).URL, "http")
+	slow := "ws" + strings.TrimPrefix(newDelayedServer(t, time.Second).URL, "http")
+	tlsServer := "wss" + strings.TrimPrefix(newTLSWebSocketServer(t).URL, "https")
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	t.Cleanup(forbidden.Close)
+	rpcFailing := newRPCServer(t, func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	})
+
+	testCases := []struct {
+		name               string
+		target             string
+		module             Module
+		expectedReason     string
+		expectedStatusCode float64
+	}{
+		{
+			name:           "Invalid URL",
+			target:         "ws://example.com:port/%zz",
+			module:         Module{Prober: "websocket"},
+			expectedReason: "invalid_url",
+		},
+		{
+			name:           "Invalid scheme",
+			target:         "http://example.com",
+			module:         Module{Prober: "websocket"},
+			expectedReason: "invalid_scheme",
+		},
+		{
+			name:           "Missing CA file",
+			target:         tlsServer,
+			module:         Module{Prober: "websocket", WebSocket: WebSocketProbe{TLSConfig: TLSConfig{CAFile: "/nonexistent/ca.pem"}}},
+			expectedReason: "config",
+		},
+		{
+			name:           "Connection refused",
+			target:         "ws://127.0.0.1:1",
+			module:         Module{Prober: "websocket"},
+			expectedReason: "connection_refused",
+		},
+		{
+			name:           "Untrusted certificate",
+			target:         tlsServer,
+			module:         Module{Prober: "websocket"},
+			expectedReason: "tls",
+		},
+		{
+			name:               "Handshake rejected",
+			target:             "ws" + strings.TrimPrefix(forbidden.URL, "http"),
+			module:             Module{Prober: "websocket"},
+			expectedReason:     "http_status",
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "Handshake timeout",
+			target:         slow,
+			module:         Module{Prober: "websocket", Timeout: 100 * time.Millisecond},
+			expectedReason: "timeout",
+		},
+		{
+			name:               "JSON-RPC error",
+			target:             rpcFailing,
+			module:             Module{Prober: "ethereum"},
+			expectedReason:     "protocol",
+			expectedStatusCode: http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "Regexp assertion",
+			target: rpcFailing,
+			module: Module{Prober: "websocket", WebSocket: WebSocketProbe{
+				Query:                  `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`,
+				FailIfNotMatchesRegexp: []Regexp{{regexp.MustCompile(`"result"`)}},
+			}},
+			expectedReason:     "assertion",
+			expectedStatusCode: http.StatusSwitchingProtocols,
+		},
+		{
+			name:   "JSONPath assertion on a missing value",
+			target: rpcFailing,
+			module: loadModule(t, `
+    prober: script
+    script:
+      steps:
+        - name: block_number
+          send: '{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}'
+          expect:
+            jsonpath:
+              - path: $.result
+`),
+			expectedReason:     "assertion",
+			expectedStatusCode: http.StatusSwitchingProtocols,
+		},
+		{
+			name:               "Success",
+			target:             healthy,
+			module:             Module{Prober: "websocket"},
+			expectedStatusCode: http.StatusSwitchingProtocols,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := probeWebSocket(context.Background(), tc.target, "", tc.module)
+			if result.FailedDueTo != tc.expectedReason {
+				t.Errorf("FailedDueTo = %q, want %q", result.FailedDueTo, tc.expectedReason)
+			}
+			if result.Success != (tc.expectedReason == "") {
+				t.Errorf("Success = %v with failure reason %q", result.Success, tc.expectedReason)
+			}
+			if got, _ := resultGauge(t, result, "probe_websocket_status_code"); got != tc.expectedStatusCode {
+				t.Errorf("probe_websocket_status_code = %v, want %v", got, tc.expectedStatusCode)
+			}
+
+			// Exactly one reason is set on failure, none on success
+			reasons := labeledGauges(t, result, "probe_failed_due_to", "reason")
+			if len(reasons) != len(failureReasons) {
+				t.Errorf("probe_failed_due_to has %d series, want %d", len(reasons), len(failureReasons))
+			}
+			for reason, value := range reasons {
+				if expected := boolToFloat64(reason == tc.expectedReason); value != expected {
+					t.Errorf("probe_failed_due_to{reason=%q} = %v, want %v", reason, value, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSONPath is a parsed JSONPath expression. Only the subset needed to point
+// at a single value is supported: `$`, `.field`, `['field']` and `[index]`,
+// where a negative index counts from the end of the array.
+type JSONPath struct {
+	raw      string
+	segments []jsonPathSegment
+}
+
+// jsonPathSegment is either an object field or an array index.
+type jsonPathSegment struct {
+	field   string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath parses expr, which must start with `$`.
+func parseJSONPath(expr string) (JSONPath, error) {
+	path := JSONPath{raw: expr}
+	if !strings.HasPrefix(expr, "$") {
+		return path, fmt.Errorf("JSONPath %q must start with $", expr)
+	}
+
+	rest := expr[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			field := rest[1 : end+1]
+			if field == "" {
+				return path, fmt.Errorf("JSONPath %q has an empty field name", expr)
+			}
+			path.segments = append(path.segments, jsonPathSegment{field: field})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return path, fmt.Errorf("JSONPath %q has an unterminated [", expr)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path.segments = append(path.segments, jsonPathSegment{field: inner[1 : len(inner)-1]})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return path, fmt.Errorf("JSONPath %q has an invalid index %q", expr, inner)
+				}
+				path.segments = append(path.segments, jsonPathSegment{index: index, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return path, fmt.Errorf("JSONPath %q has an unexpected %q", expr, rest[0])
+		}
+	}
+	return path, nil
+}
+
+// String returns the expression the path was parsed from.
+func (p JSONPath) String() string {
+	return p.raw
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (p *JSONPath) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := parseJSONPath(s)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (p JSONPath) MarshalYAML() (interface{}, error) {
+	return p.raw, nil
+}
+
+// lookup returns the value the path points at in a decoded JSON document.
+func (p JSONPath) lookup(document interface{}) (interface{}, error) {
+	current := document
+	for _, segment := range p.segments {
+		if segment.isIndex {
+			array, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: not an array", p.raw)
+			}
+			index := segment.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index < 0 || index >= len(array) {
+				return nil, fmt.Errorf("%s: index %d out of range", p.raw, segment.index)
+			}
+			current = array[index]
+			continue
+		}
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: not an object", p.raw)
+		}
+		value, ok := object[segment.field]
+		if !ok {
+			return nil, fmt.Errorf("%s: field %q not found", p.raw, segment.field)
+		}
+		current = value
+	}
+	return current, nil
+}
+
+// jsonValueString renders a decoded JSON value for comparisons: strings as
+// is, numbers without exponent and everything else as JSON.
+func jsonValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
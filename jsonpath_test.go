@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestParseJSONPath tests parsing of the supported JSONPath subset
+func TestParseJSONPath(t *testing.T) {
+	testCases := []struct {
+		input string
+		valid bool
+	}{
+		{input: "$", valid: true},
+		{input: "$.result", valid: true},
+		{input: "$.result.info[0].peers", valid: true},
+		{input: "$['params']['result']", valid: true},
+		{input: `$["params"].result[-1]`, valid: true},
+		{input: "result", valid: false},
+		{input: "$..result", valid: false},
+		{input: "$.result[abc]", valid: false},
+		{input: "$.result[0", valid: false},
+		{input: "$result", valid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := parseJSONPath(tc.input)
+			if (err == nil) != tc.valid {
+				t.Errorf("parseJSONPath(%q) error = %v, want valid %v", tc.input, err, tc.valid)
+			}
+		})
+	}
+}
+
+// TestJSONPathLookup tests resolving paths against a JSON document
+func TestJSONPathLookup(t *testing.T) {
+	var document interface{}
+	if err := json.Unmarshal([]byte(`{
+		"id": 42,
+		"result": {"peers": [{"name": "a"}, {"name": "b"}], "syncing": false, "gas.price": 1.5e9}
+	}`), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		path     string
+		expected string
+		valid    bool
+	}{
+		{path: "$.id", expected: "42", valid: true},
+		{path: "$.result.peers[1].name", expected: "b", valid: true},
+		{path: "$.result.peers[-1].name", expected: "b", valid: true},
+		{path: "$.result.syncing", expected: "false", valid: true},
+		{path: "$.result['gas.price']", expected: "1500000000", valid: true},
+		{path: "$.result.peers[0]", expected: `{"name":"a"}`, valid: true},
+		{path: "$.result.peers[2]", valid: false},
+		{path: "$.result.missing", valid: false},
+		{path: "$.id.value", valid: false},
+		{path: "$.result[0]", valid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			path, err := parseJSONPath(tc.path)
+			if err != nil {
+				t.Fatalf("parseJSONPath(%q) unexpected error: %v", tc.path, err)
+			}
+			value, err := path.lookup(document)
+			if (err == nil) != tc.valid {
+				t.Fatalf("lookup(%q) error = %v, want valid %v", tc.path, err, tc.valid)
+			}
+			if tc.valid && jsonValueString(value) != tc.expected {
+				t.Errorf("lookup(%q) = %s, want %s", tc.path, jsonValueString(value), tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rpcRequest is a JSON-RPC 2.0 request.
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// rpcMessage is any JSON-RPC 2.0 message received from the server: either a
+// response to one of our requests or a subscription notification.
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *rpcError       `json:"error,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcError is an error object returned by a JSON-RPC server.
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// rpcClient speaks JSON-RPC 2.0 over an established WebSocket connection.
+// Notifications received while waiting for a response are queued and can be
+// consumed with nextNotification.
+type rpcClient struct {
+	conn          *probeConn
+	deadline      time.Time
+	nextID        uint64
+	notifications []rpcMessage
+}
+
+// newRPCClient wraps conn and bounds all reads and writes by the ctx deadline.
+func newRPCClient(ctx context.Context, conn *probeConn) (*rpcClient, error) {
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return nil, err
+	}
+	return &rpcClient{conn: conn, deadline: deadline}, nil
+}
+
+// setReadTimeout limits the next reads to timeout from now, without ever
+// extending past the probe deadline.
+func (c *rpcClient) setReadTimeout(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if !c.deadline.IsZero() && c.deadline.Before(deadline) {
+		deadline = c.deadline
+	}
+	return c.conn.SetReadDeadline(deadline)
+}
+
+// call sends a request and decodes the result of the matching response into
+// result. JSON-RPC errors are returned as *rpcError.
+func (c *rpcClient) call(method string, params interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	c.nextID++
+	id := strconv.FormatUint(c.nextID, 10)
+
+	request := rpcRequest{JSONRPC: "2.0", ID: c.nextID, Method: method, Params: params}
+	if err := c.conn.WriteJSON(request); err != nil {
+		return fmt.Errorf("error sending %s request: %w", method, err)
+	}
+
+	for {
+		message, err := c.read()
+		if err != nil {
+			return fmt.Errorf("error reading %s response: %w", method, err)
+		}
+		if len(message.ID) == 0 {
+			c.notifications = append(c.notifications, message)
+			continue
+		}
+		// Errors for requests the server could not attribute, such as
+		// throttled ones, come back with a null id. Only one request is in
+		// flight, so such an error is the answer to it.
+		if string(message.ID) == "null" && message.Error != nil {
+			return message.Error
+		}
+		if strings.Trim(string(message.ID), `"`) != id {
+			continue
+		}
+		if message.Error != nil {
+			return message.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(message.Result, result); err != nil {
+			return fmt.Errorf("error decoding %s result: %w", method, err)
+		}
+		return nil
+	}
+}
+
+// nextNotification returns the next queued notification, reading from the
+// connection if none is pending.
+func (c *rpcClient) nextNotification() (rpcMessage, error) {
+	for len(c.notifications) == 0 {
+		message, err := c.read()
+		if err != nil {
+			return rpcMessage{}, err
+		}
+		if len(message.ID) == 0 {
+			return message, nil
+		}
+	}
+	message := c.notifications[0]
+	c.notifications = c.notifications[1:]
+	return message, nil
+}
+
+// subscribe calls a subscription method and returns the subscription ID as
+// raw JSON, since servers use both numeric and string IDs.
+func (c *rpcClient) subscribe(method string, params interface{}) (json.RawMessage, error) {
+	var subscription json.RawMessage
+	if err := c.call(method, params, &subscription); err != nil {
+		return nil, err
+	}
+	if len(subscription) == 0 || string(subscription) == "null" {
+		return nil, fmt.Errorf("%s returned no subscription ID", method)
+	}
+	return subscription, nil
+}
+
+// nextSubscriptionResult waits for the next notification of subscription and
+// decodes its result. Notifications for other subscriptions are dropped.
+func (c *rpcClient) nextSubscriptionResult(subscription json.RawMessage, result interface{}) error {
+	for {
+		received, data, err := c.nextSubscriptionNotification()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(received, subscription) {
+			continue
+		}
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("error decoding notification: %w", err)
+		}
+		return nil
+	}
+}
+
+// nextSubscriptionNotification waits for the next subscription notification
+// and returns its subscription ID and raw result.
+func (c *rpcClient) nextSubscriptionNotification() (json.RawMessage, json.RawMessage, error) {
+	notification, err := c.nextNotification()
+	if err != nil {
+		return nil, nil, err
+	}
+	var params struct {
+		Subscription json.RawMessage `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(notification.Params, &params); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s notification: %w", notification.Method, err)
+	}
+	return params.Subscription, params.Result, nil
+}
+
+// read reads and decodes a single message from the connection.
+func (c *rpcClient) read() (rpcMessage, error) {
+	var message rpcMessage
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return message, err
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return message, fmt.Errorf("invalid JSON-RPC message: %w", err)
+	}
+	return message, nil
+}
+
+// parseHexUint64 parses a 0x-prefixed hex quantity as used by Ethereum.
+func parseHexUint64(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return 0, fmt.Errorf("quantity %q is missing the 0x prefix", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
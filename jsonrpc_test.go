@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// rpcHandler answers a single JSON-RPC request for the mock server. The
+// notifications are sent right after the response; a time.Duration entry
+// pauses before sending the next one.
+type rpcHandler func(method string, params json.RawMessage) (result interface{}, rpcErr *rpcError, notifications []interface{})
+
+// newRPCServer starts a mock WebSocket server speaking JSON-RPC 2.0 and
+// returns its ws:// URL
+func newRPCServer(t *testing.T, handler rpcHandler) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				t.Logf("Failed to close connection: %v", err)
+			}
+		}()
+
+		for {
+			var request struct {
+				ID     json.RawMessage `json:"id"`
+				Method string          `json:"method"`
+				Params json.RawMessage `json:"params"`
+			}
+			if err := conn.ReadJSON(&request); err != nil {
+				return
+			}
+
+			result, rpcErr, notifications := handler(request.Method, request.Params)
+			if result == nil && rpcErr == nil && notifications == nil {
+				// Simulate a node that never answers
+				continue
+			}
+			response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+			if rpcErr != nil {
+				response["error"] = rpcErr
+			} else {
+				response["result"] = result
+			}
+			if err := conn.WriteJSON(response); err != nil {
+				return
+			}
+			for _, notification := range notifications {
+				if pause, ok := notification.(time.Duration); ok {
+					time.Sleep(pause)
+					continue
+				}
+				if err := conn.WriteJSON(notification); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// rpcNotification builds a JSON-RPC notification as sent by the mock server
+func rpcNotification(method string, params interface{}) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+// dialRPC connects an rpcClient to url for the duration of the test
+func dialRPC(t *testing.T, url string) *rpcClient {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client, err := newRPCClient(ctx, &probeConn{Conn: conn})
+	if err != nil {
+		t.Fatalf("newRPCClient() unexpected error: %v", err)
+	}
+	return client
+}
+
+// TestRPCClientCall tests request/response matching and notification queueing
+func TestRPCClientCall(t *testing.T) {
+	url := newRPCServer(t, func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		switch method {
+		case "echo":
+			return json.RawMessage(params), nil, []interface{}{rpcNotification("tick", 1), rpcNotification("tick", 2)}
+		case "fail":
+			return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+		}
+		return nil, nil, nil
+	})
+	client := dialRPC(t, url)
+
+	var echoed []string
+	if err := client.call("echo", []string{"a", "b"}, &echoed); err != nil {
+		t.Fatalf("call(echo) unexpected error: %v", err)
+	}
+	if len(echoed) != 2 || echoed[0] != "a" || echoed[1] != "b" {
+		t.Errorf("call(echo) result = %v, want [a b]", echoed)
+	}
+
+	// The notifications sent after the first response are queued while
+	// waiting for the second one
+	err := client.call("fail", nil, nil)
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Fatalf("call(fail) error = %v, want JSON-RPC error -32601", err)
+	}
+
+	for _, expected := range []string{"1", "2"} {
+		notification, err := client.nextNotification()
+		if err != nil {
+			t.Fatalf("nextNotification() unexpected error: %v", err)
+		}
+		if notification.Method != "tick" || string(notification.Params) != expected {
+			t.Errorf("nextNotification() = %s %s, want tick %s", notification.Method, notification.Params, expected)
+		}
+	}
+}
+
+// newNullIDServer starts a mock WebSocket server answering every request with
+// rpcErr and a null id, as servers do for requests they reject unparsed
+func newNullIDServer(t *testing.T, rpcErr *rpcError) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				t.Logf("Failed to close connection: %v", err)
+			}
+		}()
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": rpcErr}); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// TestRPCClientCallNullID tests that an error with a null id answers the
+// pending request
+func TestRPCClientCallNullID(t *testing.T) {
+	client := dialRPC(t, newNullIDServer(t, &rpcError{Code: -32600, Message: "invalid request"}))
+
+	err := client.call("eth_blockNumber", nil, nil)
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32600 {
+		t.Fatalf("call() error = %v, want JSON-RPC error -32600", err)
+	}
+}
+
+// TestParseHexUint64 tests parsing of Ethereum hex quantities
+func TestParseHexUint64(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected uint64
+		valid    bool
+	}{
+		{input: "0x0", expected: 0, valid: true},
+		{input: "0x1b4", expected: 436, valid: true},
+		{input: "0X10", expected: 16, valid: true},
+		{input: "1b4", valid: false},
+		{input: "0xzz", valid: false},
+		{input: "", valid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			result, err := parseHexUint64(tc.input)
+			if (err == nil) != tc.valid {
+				t.Fatalf("parseHexUint64(%q) error = %v, want valid %v", tc.input, err, tc.valid)
+			}
+			if tc.valid && result != tc.expected {
+				t.Errorf("parseHexUint64(%q) = %d, want %d", tc.input, result, tc.expected)
+			}
+		})
+	}
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -19,95 +26,335 @@ var (
 	webTelemetryPath = flag.String("web.telemetry-path", "/metrics", "Path for exporter metrics")
 	webProbePath     = flag.String("web.probe-path", "/probe", "Path for probe endpoint")
 	timeout          = flag.Duration("timeout", 10*time.Second, "Probe timeout")
+	configFile       = flag.String("config.file", "", "Path to the probe modules configuration file")
+	targetsFile      = flag.String("targets.file", "", "Path to the file mapping target aliases to URLs")
 )
 
-var (
-	websocketUp = prometheus.NewGauge(prometheus.GaugeOpts{
+// safeConfig holds the modules available to probeHandler.
+var safeConfig = &SafeConfig{C: defaultConfig()}
+
+// probeResult holds everything observed during a single probe. Each call to
+// probeWebSocket returns its own result, so concurrent scrapes of different
+// targets never share metric state.
+type probeResult struct {
+	Success            bool
+	Up                 bool
+	ConnectionDuration time.Duration
+	Duration           time.Duration
+	// StatusCode is the HTTP status of the handshake response, if any.
+	StatusCode int
+	// FailedDueTo is one of failureReasons when the probe failed.
+	FailedDueTo string
+	// RateLimited is set when the target throttled the probe.
+	RateLimited bool
+
+	// Extra holds the prober specific metrics.
+	Extra []prometheus.Collector
+}
+
+// setGauge adds a prober specific gauge with the given value to the result.
+func (r *probeResult) setGauge(name, help string, value float64) {
+	r.setLabeledGauge(name, help, nil, value)
+}
+
+// setInfo adds a prober specific info metric, whose value is always 1 and
+// whose labels carry the information.
+func (r *probeResult) setInfo(name, help string, labels prometheus.Labels) {
+	r.setLabeledGauge(name, help, labels, 1)
+}
+
+// setLabeledGauge adds one series of a prober specific gauge. Calling it
+// several times with the same name and different label values builds up a
+// metric with multiple series.
+func (r *probeResult) setLabeledGauge(name, help string, labels prometheus.Labels, value float64) {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        name,
+		Help:        help,
+		ConstLabels: labels,
+	})
+	gauge.Set(value)
+	r.Extra = append(r.Extra, gauge)
+}
+
+// collectors renders the result into a fresh set of gauges ready to be
+// registered in a per-request registry.
+func (r probeResult) collectors() []prometheus.Collector {
+	websocketUp := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "probe_websocket_up",
 		Help: "Displays whether the WebSocket connection was successful",
 	})
+	websocketUp.Set(boolToFloat64(r.Up))
 
-	websocketConnectionDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+	websocketConnectionDuration := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "probe_websocket_connection_duration_seconds",
 		Help: "Duration of the WebSocket connection establishment",
 	})
+	websocketConnectionDuration.Set(r.ConnectionDuration.Seconds())
 
-	probeDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "probe_duration_seconds",
 		Help: "Returns how long the probe took to complete in seconds",
 	})
+	probeDuration.Set(r.Duration.Seconds())
 
-	probeSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "probe_success",
 		Help: "Displays whether or not the probe was a success",
 	})
-)
+	probeSuccess.Set(boolToFloat64(r.Success))
+
+	statusCode := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_websocket_status_code",
+		Help: "HTTP status code of the WebSocket handshake response, 0 if none was received",
+	})
+	statusCode.Set(float64(r.StatusCode))
 
-func init() {
-	prometheus.MustRegister(websocketUp)
-	prometheus.MustRegister(websocketConnectionDuration)
-	prometheus.MustRegister(probeDuration)
-	prometheus.MustRegister(probeSuccess)
+	rateLimited := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_rate_limited",
+		Help: "Displays whether the target rejected the probe because of rate limits",
+	})
+	rateLimited.Set(boolToFloat64(r.RateLimited))
+
+	collectors := []prometheus.Collector{websocketUp, websocketConnectionDuration, probeDuration, probeSuccess, statusCode, rateLimited}
+	collectors = append(collectors, failureCollectors(r.FailedDueTo)...)
+	return append(collectors, r.Extra...)
+}
+
+// probeConn is the WebSocket connection handed to the probers. When record is
+// set it keeps every message read, so that the module extraction rules can be
+// applied once the prober is done.
+type probeConn struct {
+	*websocket.Conn
+	record   bool
+	received [][]byte
 }
 
-func probeWebSocket(target string) bool {
+// ReadMessage reads the next message and records it if requested.
+func (c *probeConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.Conn.ReadMessage()
+	if err == nil && c.record {
+		c.received = append(c.received, data)
+	}
+	return messageType, data, err
+}
+
+// ReadJSON reads the next message through ReadMessage and decodes it into v.
+func (c *probeConn) ReadJSON(v interface{}) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// prober runs the protocol specific checks once the WebSocket connection is
+// established. Returning an error fails the probe.
+type prober func(ctx context.Context, c *probeConn, module Module, result *probeResult) error
+
+// probers maps the module `prober` setting to its implementation.
+var probers = map[string]prober{
+	"websocket":  checkPayload,
+	"ethereum":   probeEthereum,
+	"ogmios":     probeOgmios,
+	"script":     probeScript,
+	"solana":     probeSolana,
+	"substrate":  probeSubstrate,
+	"tendermint": probeTendermint,
+	"xrpl":       probeXRPL,
+}
+
+// newDialer builds the WebSocket dialer for a module.
+func newDialer(module Module, timeout time.Duration) (*websocket.Dialer, error) {
+	tlsConfig, err := module.WebSocket.TLSConfig.newTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errModuleConfig, err)
+	}
+	return &websocket.Dialer{
+		HandshakeTimeout: timeout,
+		Subprotocols:     module.WebSocket.Subprotocols,
+		TLSClientConfig:  tlsConfig,
+	}, nil
+}
+
+// dial opens a WebSocket connection to target with the module settings. The
+// handshake is bounded by both ctx and the module timeout.
+func dial(ctx context.Context, target string, module Module) (*websocket.Conn, *http.Response, error) {
+	dialer, err := newDialer(module, module.probeTimeout())
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := module.requestHeader()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errModuleConfig, err)
+	}
+	return dialer.DialContext(ctx, target, header)
+}
+
+// probeWebSocket probes target with module. name is how the target appears in
+// the logs; when empty, the target URL is logged with the redaction rules
+// applied.
+func probeWebSocket(ctx context.Context, target, name string, module Module) (result probeResult) {
 	probeStart := time.Now()
-	success := false
 	defer func() {
-		probeDuration.Set(time.Since(probeStart).Seconds())
-		probeSuccess.Set(boolToFloat64(success))
+		result.Duration = time.Since(probeStart)
 	}()
 
-	websocketUp.Set(0)
-	websocketConnectionDuration.Set(0)
-
+	// The parse error embeds the raw target, so only its cause is printed
 	targetURL, err := url.Parse(target)
 	if err != nil {
-		fmt.Printf("Invalid target URL %s: %v\n", target, err)
-		return false
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		fmt.Printf("Invalid target URL: %v\n", err)
+		result.FailedDueTo = "invalid_url"
+		return result
+	}
+	// displayTarget is the target as it appears in the logs
+	displayTarget := name
+	if displayTarget == "" {
+		displayTarget = safeConfig.redaction().redact(targetURL)
 	}
 
 	// Ensure URL uses ws:// or wss:// scheme
 	if targetURL.Scheme != "ws" && targetURL.Scheme != "wss" {
 		fmt.Printf("Invalid URL scheme %s, must be ws or wss\n", targetURL.Scheme)
-		return false
+		result.FailedDueTo = "invalid_scheme"
+		return result
+	}
+
+	probe, ok := probers[module.Prober]
+	if !ok {
+		fmt.Printf("Unknown prober %q\n", module.Prober)
+		result.FailedDueTo = "config"
+		return result
 	}
 
 	// Create context with timeout
-	ctxTimeout, cancel := context.WithTimeout(context.Background(), *timeout)
+	ctxTimeout, cancel := context.WithTimeout(ctx, module.probeTimeout())
 	defer cancel()
 
-	dialer := websocket.Dialer{
-		HandshakeTimeout: *timeout,
-	}
-
 	connectStart := time.Now()
 
-	c, resp, err := dialer.DialContext(ctxTimeout, targetURL.String(), nil)
+	tracer := newPhaseTracer()
+	conn, resp, err := dial(httptrace.WithClientTrace(ctxTimeout, tracer.clientTrace()), targetURL.String(), module)
+	tracer.done("upgrade")
+	tracer.report(&result)
+	if resp != nil {
+		result.StatusCode = resp.StatusCode
+	}
 	if err != nil {
 		if resp != nil {
-			fmt.Printf("Failed to connect to %s: %v (HTTP status: %d)\n", targetURL.String(), err, resp.StatusCode)
+			fmt.Printf("Failed to connect to %s: %v (HTTP status: %d)\n", displayTarget, err, resp.StatusCode)
+			result.FailedDueTo = "http_status"
+			if resp.StatusCode == http.StatusTooManyRequests {
+				result.setRateLimited(module, resp.Header)
+			}
 		} else {
-			fmt.Printf("Failed to connect to %s: %v\n", targetURL.String(), err)
+			fmt.Printf("Failed to connect to %s: %v\n", displayTarget, err)
+			result.FailedDueTo = failureReason(err, "connection")
 		}
-		return false
+		return result
 	}
 	defer func() {
-		err := c.Close()
+		err := conn.Close()
 		if err != nil {
 			fmt.Printf("Error closing connection: %v\n", err)
 		}
 	}()
 
 	// Record connection metrics
-	connectionDuration := time.Since(connectStart)
-	websocketConnectionDuration.Set(connectionDuration.Seconds())
-	websocketUp.Set(1)
-	fmt.Printf("Connected to %s in %s\n", targetURL.String(), connectionDuration)
+	result.ConnectionDuration = time.Since(connectStart)
+	result.Up = true
+	fmt.Printf("Connected to %s in %s\n", displayTarget, result.ConnectionDuration)
+
+	if tlsConn, ok := conn.UnderlyingConn().(*tls.Conn); ok {
+		setTLSMetrics(tlsConn.ConnectionState(), &result)
+	}
+
+	// Extraction also runs when the probe fails, since the values received
+	// until then are still worth exporting
+	c := &probeConn{Conn: conn, record: len(module.Extract) > 0}
+	if c.record {
+		defer func() {
+			extractMetrics(c.received, module.Extract, &result)
+		}()
+	}
+
+	if module.VerifyChain.Type != "" {
+		if err := verifyChain(ctxTimeout, c, module.VerifyChain, &result); err != nil {
+			fmt.Printf("Chain verification of %s failed: %v\n", displayTarget, err)
+			result.FailedDueTo = failureReason(err, "protocol")
+			if isRateLimitError(err) {
+				result.setRateLimited(module, nil)
+			}
+			return result
+		}
+	}
+
+	if err := probe(ctxTimeout, c, module, &result); err != nil {
+		fmt.Printf("Probe of %s failed: %v\n", displayTarget, err)
+		result.FailedDueTo = failureReason(err, "protocol")
+		if isRateLimitError(err) {
+			result.setRateLimited(module, nil)
+		}
+		return result
+	}
+
+	if module.WebSocket.Ping.Count > 0 {
+		if err := pingPong(ctxTimeout, c, module.WebSocket.Ping, &result); err != nil {
+			fmt.Printf("Ping of %s failed: %v\n", displayTarget, err)
+			result.FailedDueTo = failureReason(err, "protocol")
+			return result
+		}
+	}
 
 	// Consider the probe successful if the connection was established
-	success = true
-	return success
+	// and the prober checks passed
+	result.Success = true
+	return result
+}
+
+// checkPayload sends the configured query and matches the first message
+// received against the module regexps. It is a no-op when neither is set.
+func checkPayload(ctx context.Context, c *probeConn, module Module, result *probeResult) error {
+	settings := module.WebSocket
+	if settings.Query != "" {
+		if deadline, ok := ctx.Deadline(); ok {
+			if err := c.SetWriteDeadline(deadline); err != nil {
+				return err
+			}
+		}
+		if err := c.WriteMessage(websocket.TextMessage, []byte(settings.Query)); err != nil {
+			return fmt.Errorf("error sending query: %w", err)
+		}
+	}
+
+	if len(settings.FailIfMatchesRegexp) == 0 && len(settings.FailIfNotMatchesRegexp) == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := c.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	_, message, err := c.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("error reading message: %w", err)
+	}
+
+	for _, re := range settings.FailIfMatchesRegexp {
+		if re.Match(message) {
+			return assertionf("message matched regexp %q", re.String())
+		}
+	}
+	for _, re := range settings.FailIfNotMatchesRegexp {
+		if !re.Match(message) {
+			return assertionf("message did not match regexp %q", re.String())
+		}
+	}
+	return nil
 }
 
 func probeHandler(w http.ResponseWriter, r *http.Request) {
@@ -117,20 +364,113 @@ func probeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	moduleName := r.URL.Query().Get("module")
+
+	// Targets without a scheme are aliases from the targets file. The URL of
+	// an alias often embeds a key, so the logs only show the alias.
+	var (
+		displayTarget string
+		targetHeaders map[string]string
+	)
+	if isAlias(target) {
+		displayTarget = target
+		entry, ok := safeTargets.target(target)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown target %q", target), http.StatusBadRequest)
+			return
+		}
+		target = entry.URL
+		targetHeaders = entry.Headers
+		if moduleName == "" {
+			moduleName = entry.Module
+		}
+	}
+
+	if moduleName == "" {
+		moduleName = defaultModuleName
+	}
+	module, ok := safeConfig.module(moduleName)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	if displayTarget == "" {
+		displayTarget = redactTarget(target)
+	}
+	result := probeWebSocket(r.Context(), target, displayTarget, module.withHeaders(targetHeaders))
+
 	// Create a fresh registry for this probe
+	// Extraction rules can name metrics that clash with the prober ones, which
+	// must not take down the whole scrape
 	registry := prometheus.NewRegistry()
-	registry.MustRegister(websocketUp)
-	registry.MustRegister(websocketConnectionDuration)
-	registry.MustRegister(probeDuration)
-	registry.MustRegister(probeSuccess)
-
-	probeWebSocket(target)
+	for _, collector := range result.collectors() {
+		if err := registry.Register(collector); err != nil {
+			fmt.Printf("Error registering metric for %s: %v\n", displayTarget, err)
+		}
+	}
 
 	// Return metrics
 	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
 	h.ServeHTTP(w, r)
 }
 
+// reload reloads the configuration and targets files in use. Both files are
+// loaded before either is swapped in, so that the target modules are checked
+// against the configuration they will be used with, and a broken file keeps
+// both active. The outcome is exposed in the reload metrics.
+func reload() (err error) {
+	defer func() {
+		if err != nil {
+			configReloadSuccess.Set(0)
+			return
+		}
+		configReloadSuccess.Set(1)
+		configReloadSeconds.SetToCurrentTime()
+	}()
+
+	if *configFile == "" && *targetsFile == "" {
+		return errors.New("no config file configured")
+	}
+	cfg := safeConfig.config()
+	if *configFile != "" {
+		if cfg, err = loadConfig(*configFile); err != nil {
+			return err
+		}
+	}
+	var targets *TargetsConfig
+	if *targetsFile != "" {
+		if targets, err = loadTargets(*targetsFile, cfg); err != nil {
+			return err
+		}
+	}
+
+	if *configFile != "" {
+		safeConfig.set(cfg)
+		log.Printf("Loaded configuration from %s", *configFile)
+	}
+	if targets != nil {
+		safeTargets.set(targets)
+		log.Printf("Loaded %d targets from %s", len(targets.Targets), *targetsFile)
+	}
+	return nil
+}
+
+// reloadHandler reloads the configuration on POST requests.
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "This endpoint requires a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := reload(); err != nil {
+		log.Printf("Error reloading config: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to reload config: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
 func boolToFloat64(b bool) float64 {
 	if b {
 		return 1
@@ -141,9 +481,30 @@ func boolToFloat64(b bool) float64 {
 func main() {
 	flag.Parse()
 
+	// Without any file the built-in configuration is in use, which counts
+	// as successfully loaded
+	if *configFile == "" && *targetsFile == "" {
+		configReloadSuccess.Set(1)
+		configReloadSeconds.SetToCurrentTime()
+	} else if err := reload(); err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	// Reload the configuration on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reload(); err != nil {
+				log.Printf("Error reloading config: %v", err)
+			}
+		}
+	}()
+
 	// Setup HTTP server
 	http.Handle(*webTelemetryPath, promhttp.Handler())
 	http.HandleFunc(*webProbePath, probeHandler)
+	http.HandleFunc("/-/reload", reloadHandler)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if _, err := w.Write([]byte(`<html>
 			<head><title>WebSocket Exporter</title></head>
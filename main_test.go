@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -39,18 +40,6 @@ func TestProbeWebSocket(t *testing.T) {
 	// Convert HTTP URL to WebSocket URL
 	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
 
-	// Reset metrics before test
-	prometheus.Unregister(websocketUp)
-	prometheus.Unregister(websocketConnectionDuration)
-	prometheus.Unregister(probeDuration)
-	prometheus.Unregister(probeSuccess)
-
-	// Re-register metrics
-	prometheus.MustRegister(websocketUp)
-	prometheus.MustRegister(websocketConnectionDuration)
-	prometheus.MustRegister(probeDuration)
-	prometheus.MustRegister(probeSuccess)
-
 	// Test cases
 	testCases := []struct {
 		name     string
@@ -80,25 +69,22 @@ func TestProbeWebSocket(t *testing.T) {
 			*timeout = 1 * time.Second
 
 			// Test the probeWebSocket function
-			result := probeWebSocket(tc.target)
+			result := probeWebSocket(context.Background(), tc.target, "", Module{Prober: "websocket"})
 
-			if result != tc.expected {
-				t.Errorf("probeWebSocket(%s) = %v, want %v", tc.target, result, tc.expected)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket(%s).Success = %v, want %v", tc.target, result.Success, tc.expected)
 			}
 
-			// For successful connections, verify metrics were set correctly
+			// For successful connections, verify the result was filled in correctly
 			if tc.expected {
-				if value := testutil.ToFloat64(probeSuccess); value != 1 {
-					t.Errorf("probeSuccess metric = %v, want 1", value)
-				}
-				if value := testutil.ToFloat64(websocketUp); value != 1 {
-					t.Errorf("websocketUp metric = %v, want 1", value)
+				if !result.Up {
+					t.Errorf("result.Up = %v, want true", result.Up)
 				}
-				if value := testutil.ToFloat64(websocketConnectionDuration); value <= 0 {
-					t.Errorf("websocketConnectionDuration metric = %v, want > 0", value)
+				if result.ConnectionDuration <= 0 {
+					t.Errorf("result.ConnectionDuration = %v, want > 0", result.ConnectionDuration)
 				}
-				if value := testutil.ToFloat64(probeDuration); value <= 0 {
-					t.Errorf("probeDuration metric = %v, want > 0", value)
+				if result.Duration <= 0 {
+					t.Errorf("result.Duration = %v, want > 0", result.Duration)
 				}
 			}
 		})
@@ -362,33 +348,28 @@ func TestRootHandler(t *testing.T) {
 // TestInvalidURLScheme tests handling of URLs with invalid schemes
 func TestInvalidURLScheme(t *testing.T) {
 	// Test with HTTP scheme (not ws/wss)
-	result := probeWebSocket("http://example.com")
+	result := probeWebSocket(context.Background(), "http://example.com", "", Module{Prober: "websocket"})
 
-	if result != false {
-		t.Errorf("probeWebSocket() with invalid scheme = %v, want false", result)
+	if result.Success {
+		t.Errorf("probeWebSocket() with invalid scheme = %v, want false", result.Success)
 	}
 
-	// Verify metrics
-	if value := testutil.ToFloat64(probeSuccess); value != 0 {
-		t.Errorf("probeSuccess metric = %v, want 0", value)
-	}
-
-	if value := testutil.ToFloat64(websocketUp); value != 0 {
-		t.Errorf("websocketUp metric = %v, want 0", value)
+	if result.Up {
+		t.Errorf("result.Up = %v, want false", result.Up)
 	}
 }
 
 // TestContextCancellation tests handling of context cancellation
 func TestContextCancellation(t *testing.T) {
 	// Create a context and cancel it immediately
-	_, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
 
 	// Test with cancelled context
-	result := probeWebSocket("ws://example.com")
+	result := probeWebSocket(ctx, "ws://example.com", "", Module{Prober: "websocket"})
 
-	if result != false {
-		t.Errorf("probeWebSocket() with cancelled context = %v, want false", result)
+	if result.Success {
+		t.Errorf("probeWebSocket() with cancelled context = %v, want false", result.Success)
 	}
 }
 
@@ -559,36 +540,53 @@ func TestMainFunction(t *testing.T) {
 }
 
 func TestMetricsRegistration(t *testing.T) {
-	// Reset metrics
-	prometheus.Unregister(websocketUp)
-	prometheus.Unregister(websocketConnectionDuration)
-	prometheus.Unregister(probeDuration)
-	prometheus.Unregister(probeSuccess)
-
-	// Re-register metrics
-	prometheus.MustRegister(websocketUp)
-	prometheus.MustRegister(websocketConnectionDuration)
-	prometheus.MustRegister(probeDuration)
-	prometheus.MustRegister(probeSuccess)
-
-	// Test metric values
-	websocketUp.Set(1)
-	websocketConnectionDuration.Set(0.5)
-	probeDuration.Set(1.0)
-	probeSuccess.Set(1)
-
-	// Verify metric values
-	if value := testutil.ToFloat64(websocketUp); value != 1 {
-		t.Errorf("websocketUp = %v, want 1", value)
-	}
-	if value := testutil.ToFloat64(websocketConnectionDuration); value != 0.5 {
-		t.Errorf("websocketConnectionDuration = %v, want 0.5", value)
-	}
-	if value := testutil.ToFloat64(probeDuration); value != 1.0 {
-		t.Errorf("probeDuration = %v, want 1.0", value)
-	}
-	if value := testutil.ToFloat64(probeSuccess); value != 1 {
-		t.Errorf("probeSuccess = %v, want 1", value)
+	result := probeResult{
+		Success:            true,
+		Up:                 true,
+		ConnectionDuration: 500 * time.Millisecond,
+		Duration:           time.Second,
+		StatusCode:         http.StatusSwitchingProtocols,
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(result.collectors()...)
+
+	expected := `
+# HELP probe_duration_seconds Returns how long the probe took to complete in seconds
+# TYPE probe_duration_seconds gauge
+probe_duration_seconds 1
+# HELP probe_failed_due_to Indicates the reason the probe failed
+# TYPE probe_failed_due_to gauge
+probe_failed_due_to{reason="assertion"} 0
+probe_failed_due_to{reason="config"} 0
+probe_failed_due_to{reason="connection"} 0
+probe_failed_due_to{reason="connection_refused"} 0
+probe_failed_due_to{reason="dns"} 0
+probe_failed_due_to{reason="http_status"} 0
+probe_failed_due_to{reason="invalid_scheme"} 0
+probe_failed_due_to{reason="invalid_url"} 0
+probe_failed_due_to{reason="protocol"} 0
+probe_failed_due_to{reason="rate_limited"} 0
+probe_failed_due_to{reason="timeout"} 0
+probe_failed_due_to{reason="tls"} 0
+# HELP probe_rate_limited Displays whether the target rejected the probe because of rate limits
+# TYPE probe_rate_limited gauge
+probe_rate_limited 0
+# HELP probe_success Displays whether or not the probe was a success
+# TYPE probe_success gauge
+probe_success 1
+# HELP probe_websocket_connection_duration_seconds Duration of the WebSocket connection establishment
+# TYPE probe_websocket_connection_duration_seconds gauge
+probe_websocket_connection_duration_seconds 0.5
+# HELP probe_websocket_status_code HTTP status code of the WebSocket handshake response, 0 if none was received
+# TYPE probe_websocket_status_code gauge
+probe_websocket_status_code 101
+# HELP probe_websocket_up Displays whether the WebSocket connection was successful
+# TYPE probe_websocket_up gauge
+probe_websocket_up 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
 	}
 }
 
@@ -627,37 +625,180 @@ func TestProbeWebSocketErrorHandling(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Reset metrics before test
-			prometheus.Unregister(websocketUp)
-			prometheus.Unregister(websocketConnectionDuration)
-			prometheus.Unregister(probeDuration)
-			prometheus.Unregister(probeSuccess)
-
-			// Re-register metrics
-			prometheus.MustRegister(websocketUp)
-			prometheus.MustRegister(websocketConnectionDuration)
-			prometheus.MustRegister(probeDuration)
-			prometheus.MustRegister(probeSuccess)
-
 			// Test the probeWebSocket function
-			result := probeWebSocket(tc.target)
+			result := probeWebSocket(context.Background(), tc.target, "", Module{Prober: "websocket"})
 
-			if result != tc.expected {
-				t.Errorf("probeWebSocket(%s) = %v, want %v", tc.target, result, tc.expected)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket(%s).Success = %v, want %v", tc.target, result.Success, tc.expected)
 			}
 
-			// Verify metrics were set correctly for failed probes
+			// Verify the result was left empty for failed probes
 			if !tc.expected {
-				if value := testutil.ToFloat64(probeSuccess); value != 0 {
-					t.Errorf("probeSuccess metric = %v, want 0", value)
+				if result.Up {
+					t.Errorf("result.Up = %v, want false", result.Up)
 				}
-				if value := testutil.ToFloat64(websocketUp); value != 0 {
-					t.Errorf("websocketUp metric = %v, want 0", value)
-				}
-				if value := testutil.ToFloat64(websocketConnectionDuration); value != 0 {
-					t.Errorf("websocketConnectionDuration metric = %v, want 0", value)
+				if result.ConnectionDuration != 0 {
+					t.Errorf("result.ConnectionDuration = %v, want 0", result.ConnectionDuration)
 				}
 			}
 		})
 	}
 }
+
+// newDelayedServer starts a mock WebSocket server that waits for delay before
+// completing the handshake, so each server produces a distinguishable latency.
+func newDelayedServer(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestConcurrentProbes runs many probes in parallel against servers with
+// different latencies and checks that each result only reflects its own target
+func TestConcurrentProbes(t *testing.T) {
+	*timeout = 5 * time.Second
+
+	const servers = 8
+	delays := make([]time.Duration, servers)
+	targets := make([]string, servers)
+	for i := range servers {
+		delays[i] = time.Duration(i*25) * time.Millisecond
+		targets[i] = "ws" + strings.TrimPrefix(newDelayedServer(t, delays[i]).URL, "http")
+	}
+
+	var wg sync.WaitGroup
+	results := make([]probeResult, servers*4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = probeWebSocket(context.Background(), targets[i%servers], "", Module{Prober: "websocket"})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		delay := delays[i%servers]
+		if !result.Success || !result.Up {
+			t.Errorf("probe %d: Success = %v, Up = %v, want true", i, result.Success, result.Up)
+		}
+		if result.ConnectionDuration < delay {
+			t.Errorf("probe %d: ConnectionDuration = %v, want >= %v", i, result.ConnectionDuration, delay)
+		}
+		if result.Duration < result.ConnectionDuration {
+			t.Errorf("probe %d: Duration = %v, want >= ConnectionDuration %v", i, result.Duration, result.ConnectionDuration)
+		}
+	}
+}
+
+// TestConcurrentProbeHandler fires parallel scrapes at healthy and dead
+// targets and checks that no response carries another target's outcome
+func TestConcurrentProbeHandler(t *testing.T) {
+	*timeout = 5 * time.Second
+
+	healthy := "ws" + strings.TrimPrefix(newDelayedServer(t, 50*time.Millisecond).URL, "http")
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL := "ws" + strings.TrimPrefix(dead.URL, "http")
+	dead.Close()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		target, want := healthy, "probe_success 1"
+		if i%2 == 1 {
+			target, want = deadURL, "probe_success 0"
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/probe?target="+url.QueryEscape(target), nil)
+			rr := httptest.NewRecorder()
+			probeHandler(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("target %s: status = %d, want %d", target, rr.Code, http.StatusOK)
+			}
+			if body := rr.Body.String(); !strings.Contains(body, want) {
+				t.Errorf("target %s: response missing %q:\n%s", target, want, body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// gaugeSeries is one series of a gauge rendered from a probe result
+type gaugeSeries struct {
+	labels map[string]string
+	value  float64
+}
+
+// resultSeries returns the series of the named gauge rendered from result
+func resultSeries(t *testing.T, result probeResult, name string) []gaugeSeries {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(result.collectors()...)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	var series []gaugeSeries
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			series = append(series, gaugeSeries{labels: labels, value: metric.GetGauge().GetValue()})
+		}
+	}
+	return series
+}
+
+// resultGauge returns the value of the named gauge rendered from result
+func resultGauge(t *testing.T, result probeResult, name string) (float64, bool) {
+	t.Helper()
+	series := resultSeries(t, result, name)
+	if len(series) == 0 {
+		return 0, false
+	}
+	return series[0].value, true
+}
+
+// resultLabels returns the labels of the first series of the named gauge
+// rendered from result
+func resultLabels(t *testing.T, result probeResult, name string) map[string]string {
+	t.Helper()
+	series := resultSeries(t, result, name)
+	if len(series) == 0 {
+		return nil
+	}
+	return series[0].labels
+}
+
+// labeledGauges returns the values of the named gauge rendered from result,
+// keyed by the value of label
+func labeledGauges(t *testing.T, result probeResult, name, label string) map[string]float64 {
+	t.Helper()
+	values := make(map[string]float64)
+	for _, series := range resultSeries(t, result, name) {
+		if value, ok := series.labels[label]; ok {
+			values[value] = series.value
+		}
+	}
+	return values
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Cardano mainnet timing since the Shelley hard fork, used to turn slots
+// into wall clock time when the module does not override it.
+var (
+	cardanoMainnetShelleySlot = uint64(4492800)
+	cardanoMainnetShelleyTime = time.Date(2020, time.July, 29, 21, 44, 51, 0, time.UTC)
+)
+
+// ogmiosTip is the result of queryNetwork/tip.
+type ogmiosTip struct {
+	Slot uint64 `json:"slot"`
+	ID   string `json:"id"`
+}
+
+// probeOgmios queries the network tip and block height of a Cardano node
+// through Ogmios, which speaks JSON-RPC 2.0 over WebSocket.
+func probeOgmios(ctx context.Context, c *probeConn, module Module, result *probeResult) error {
+	settings := module.Ogmios
+	client, err := newRPCClient(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	// Ogmios expects named parameters, even when there are none
+	var rawTip json.RawMessage
+	if err := client.call("queryNetwork/tip", struct{}{}, &rawTip); err != nil {
+		return err
+	}
+	if string(rawTip) == `"origin"` {
+		return assertionf("network tip is at origin")
+	}
+	var tip ogmiosTip
+	if err := json.Unmarshal(rawTip, &tip); err != nil {
+		return fmt.Errorf("invalid network tip: %w", err)
+	}
+	result.setGauge("probe_ogmios_slot", "Slot of the network tip", float64(tip.Slot))
+	result.setGauge("probe_ogmios_tip_age_seconds", "Age of the network tip based on its slot", time.Since(settings.slotTime(tip.Slot)).Seconds())
+
+	var rawHeight json.RawMessage
+	if err := client.call("queryNetwork/blockHeight", struct{}{}, &rawHeight); err != nil {
+		return err
+	}
+	var height uint64
+	if err := json.Unmarshal(rawHeight, &height); err != nil {
+		return fmt.Errorf("invalid block height %s: %w", rawHeight, err)
+	}
+	result.setGauge("probe_ogmios_block_height", "Block height of the network tip", float64(height))
+	return nil
+}
+
+// slotTime returns the wall clock time at which slot started.
+func (o OgmiosProbe) slotTime(slot uint64) time.Time {
+	referenceSlot, referenceTime, slotLength := cardanoMainnetShelleySlot, cardanoMainnetShelleyTime, time.Second
+	if !o.ReferenceTime.IsZero() {
+		referenceSlot, referenceTime = o.ReferenceSlot, o.ReferenceTime
+	}
+	if o.SlotLength > 0 {
+		slotLength = o.SlotLength
+	}
+	return referenceTime.Add(time.Duration(int64(slot)-int64(referenceSlot)) * slotLength)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// ogmiosHandler is a mock Ogmios answering the network queries
+func ogmiosHandler(tip interface{}, height interface{}) rpcHandler {
+	return func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		if string(params) != "{}" {
+			return nil, &rpcError{Code: -32602, Message: "invalid params"}, nil
+		}
+		switch method {
+		case "queryNetwork/tip":
+			return tip, nil, nil
+		case "queryNetwork/blockHeight":
+			return height, nil, nil
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	}
+}
+
+// TestProbeOgmios tests the network tip and block height queries
+func TestProbeOgmios(t *testing.T) {
+	// A tip 20 slots in the past on a network with one second slots
+	referenceTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	settings := OgmiosProbe{ReferenceSlot: 1000, ReferenceTime: referenceTime, SlotLength: time.Second}
+	tipSlot := uint64(1000 + 3600 - 20)
+
+	testCases := []struct {
+		name     string
+		handler  rpcHandler
+		expected bool
+	}{
+		{
+			name:     "Healthy node",
+			handler:  ogmiosHandler(map[string]interface{}{"slot": tipSlot, "id": "abcd"}, 10500000),
+			expected: true,
+		},
+		{
+			name:     "Tip at origin",
+			handler:  ogmiosHandler("origin", "origin"),
+			expected: false,
+		},
+		{
+			name:     "Block height at origin",
+			handler:  ogmiosHandler(map[string]interface{}{"slot": tipSlot, "id": "abcd"}, "origin"),
+			expected: false,
+		},
+		{
+			name: "Protocol error",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				return nil, &rpcError{Code: 2001, Message: "unavailable in current era"}, nil
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := newRPCServer(t, tc.handler)
+			module := Module{Prober: "ogmios", Timeout: time.Second, Ogmios: settings}
+
+			result := probeWebSocket(context.Background(), url, "", module)
+			if result.Success != tc.expected {
+				t.Fatalf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if !tc.expected {
+				return
+			}
+
+			if value, _ := resultGauge(t, result, "probe_ogmios_slot"); value != float64(tipSlot) {
+				t.Errorf("probe_ogmios_slot = %v, want %v", value, tipSlot)
+			}
+			if value, _ := resultGauge(t, result, "probe_ogmios_block_height"); value != 10500000 {
+				t.Errorf("probe_ogmios_block_height = %v, want 10500000", value)
+			}
+			if value, _ := resultGauge(t, result, "probe_ogmios_tip_age_seconds"); value < 19 || value > 25 {
+				t.Errorf("probe_ogmios_tip_age_seconds = %v, want about 20", value)
+			}
+		})
+	}
+}
+
+// TestOgmiosSlotTime tests the slot to wall clock conversion
+func TestOgmiosSlotTime(t *testing.T) {
+	mainnetSlot := uint64(133660800)
+	expected := time.Date(2024, time.September, 1, 21, 44, 51, 0, time.UTC)
+	if got := (OgmiosProbe{}).slotTime(mainnetSlot); !got.Equal(expected) {
+		t.Errorf("mainnet slotTime(%d) = %v, want %v", mainnetSlot, got, expected)
+	}
+
+	custom := OgmiosProbe{ReferenceSlot: 0, ReferenceTime: time.Unix(1000, 0), SlotLength: 20 * time.Second}
+	if got := custom.slotTime(3); !got.Equal(time.Unix(1060, 0)) {
+		t.Errorf("custom slotTime(3) = %v, want %v", got, time.Unix(1060, 0))
+	}
+}
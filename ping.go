@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxPingCount bounds the pings sent per probe.
+const maxPingCount = 100
+
+// defaultPongTimeout bounds the wait for each pong when the module does not
+// set one, so endpoints that never answer pings do not hold the probe until
+// its timeout.
+const defaultPongTimeout = time.Second
+
+// validate checks the ping settings.
+func (s PingSettings) validate() error {
+	if s.Count < 0 || s.Count > maxPingCount {
+		return fmt.Errorf("count must be between 0 and %d, got %d", maxPingCount, s.Count)
+	}
+	if s.Interval < 0 {
+		return fmt.Errorf("interval must not be negative, got %s", s.Interval)
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", s.Timeout)
+	}
+	if s.ExpectPong && s.Count == 0 {
+		return errors.New("expect_pong requires count to be set")
+	}
+	return nil
+}
+
+// pingPong sends the configured number of pings one after the other, waiting
+// for each pong before sending the next ping. Control frames are only
+// processed while reading, so a reader goroutine runs until the pings are
+// done; the data messages it reads are discarded, since the prober is done
+// with the connection.
+func pingPong(ctx context.Context, c *probeConn, settings PingSettings, result *probeResult) error {
+	pongs := make(chan string, settings.Count)
+	c.SetPongHandler(func(appData string) error {
+		select {
+		case pongs <- appData:
+		default:
+		}
+		return nil
+	})
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := c.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			if _, _, err := c.Conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		// Unblock the reader, the connection is closed right after
+		_ = c.SetReadDeadline(time.Now())
+		<-readerDone
+	}()
+
+	pongTimeout := settings.Timeout
+	if pongTimeout == 0 {
+		pongTimeout = defaultPongTimeout
+	}
+
+	var rtts []time.Duration
+	sent := 0
+	for i := 0; i < settings.Count && ctx.Err() == nil; i++ {
+		if i > 0 && settings.Interval > 0 {
+			select {
+			case <-time.After(settings.Interval):
+			case <-ctx.Done():
+				continue
+			}
+		}
+
+		deadline := time.Now().Add(pongTimeout)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		payload := strconv.Itoa(i)
+		start := time.Now()
+		if err := c.WriteControl(websocket.PingMessage, []byte(payload), deadline); err != nil {
+			fmt.Printf("Error sending ping: %v\n", err)
+			break
+		}
+		sent++
+		if received, ok := waitPong(payload, deadline, pongs, readerDone); ok {
+			rtts = append(rtts, received.Sub(start))
+		}
+	}
+
+	// Pings that could not be sent count as lost too
+	lost := settings.Count - len(rtts)
+	reportPingRTT(rtts, sent, lost, result)
+	if settings.ExpectPong && lost > 0 {
+		return assertionf("%d of %d pongs lost", lost, settings.Count)
+	}
+	return nil
+}
+
+// waitPong waits until deadline for the pong carrying payload and returns
+// when it was received. Pongs of earlier pings arriving late are skipped.
+func waitPong(payload string, deadline time.Time, pongs <-chan string, readerDone <-chan struct{}) (time.Time, bool) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for {
+		select {
+		case appData := <-pongs:
+			if appData == payload {
+				return time.Now(), true
+			}
+		case <-timer.C:
+			return time.Time{}, false
+		case <-readerDone:
+			// The connection is gone, no pong can arrive anymore
+			return time.Time{}, false
+		}
+	}
+}
+
+// reportPingRTT exports the round trip time statistics of the pongs received
+// and the number of pongs lost.
+func reportPingRTT(rtts []time.Duration, sent, lost int, result *probeResult) {
+	result.setGauge("probe_websocket_pings_sent", "Number of WebSocket ping frames sent", float64(sent))
+	result.setGauge("probe_websocket_pongs_lost", "Number of WebSocket pings that were not answered with a pong in time", float64(lost))
+	if len(rtts) == 0 {
+		return
+	}
+
+	minRTT, maxRTT, sum := rtts[0].Seconds(), rtts[0].Seconds(), 0.0
+	for _, rtt := range rtts {
+		seconds := rtt.Seconds()
+		minRTT = math.Min(minRTT, seconds)
+		maxRTT = math.Max(maxRTT, seconds)
+		sum += seconds
+	}
+	avg := sum / float64(len(rtts))
+	variance := 0.0
+	for _, rtt := range rtts {
+		variance += (rtt.Seconds() - avg) * (rtt.Seconds() - avg)
+	}
+	stddev := math.Sqrt(variance / float64(len(rtts)))
+
+	const help = "Round trip time of WebSocket ping frames, by statistic over the pongs received"
+	for stat, value := range map[string]float64{"min": minRTT, "avg": avg, "max": maxRTT, "stddev": stddev} {
+		result.setLabeledGauge("probe_websocket_ping_rtt_seconds", help, prometheus.Labels{"stat": stat}, value)
+	}
+}
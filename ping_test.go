@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newPingServer starts a mock WebSocket server that answers pings after
+// delay, or never when answer is false, and returns its ws:// URL
+func newPingServer(t *testing.T, answer bool, delay time.Duration) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				t.Logf("Failed to close connection: %v", err)
+			}
+		}()
+		conn.SetPingHandler(func(appData string) error {
+			if !answer {
+				return nil
+			}
+			time.Sleep(delay)
+			return conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// TestProbeWebSocketPing tests the ping round trip metrics and the handling
+// of endpoints that do not answer pings
+func TestProbeWebSocketPing(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	answering := newPingServer(t, true, delay)
+	silent := newPingServer(t, false, 0)
+
+	testCases := []struct {
+		name            string
+		target          string
+		settings        PingSettings
+		expectedSuccess bool
+		expectedLost    float64
+		expectedRTT     bool
+	}{
+		{
+			name:            "Answered pings",
+			target:          answering,
+			settings:        PingSettings{Count: 3, Interval: 10 * time.Millisecond, ExpectPong: true},
+			expectedSuccess: true,
+			expectedRTT:     true,
+		},
+		{
+			name:            "Unanswered pings",
+			target:          silent,
+			settings:        PingSettings{Count: 3, Timeout: 50 * time.Millisecond},
+			expectedSuccess: true,
+			expectedLost:    3,
+		},
+		{
+			name:            "Unanswered ping with the default timeout",
+			target:          silent,
+			settings:        PingSettings{Count: 1},
+			expectedSuccess: true,
+			expectedLost:    1,
+		},
+		{
+			name:         "Unanswered pings with expect_pong",
+			target:       silent,
+			settings:     PingSettings{Count: 3, Timeout: 50 * time.Millisecond, ExpectPong: true},
+			expectedLost: 3,
+		},
+		{
+			name:         "Pongs slower than the timeout",
+			target:       answering,
+			settings:     PingSettings{Count: 2, Timeout: delay / 4, ExpectPong: true},
+			expectedLost: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module := Module{Prober: "websocket", Timeout: 2 * time.Second}
+			module.WebSocket.Ping = tc.settings
+
+			result := probeWebSocket(context.Background(), tc.target, "", module)
+			// Lost pongs must not hold the probe until the module timeout
+			if result.Duration >= module.Timeout {
+				t.Errorf("Duration = %s, want less than the module timeout %s", result.Duration, module.Timeout)
+			}
+			if result.Success != tc.expectedSuccess {
+				t.Errorf("Success = %v, want %v", result.Success, tc.expectedSuccess)
+			}
+			if !tc.expectedSuccess && result.FailedDueTo != "assertion" {
+				t.Errorf("FailedDueTo = %q, want assertion", result.FailedDueTo)
+			}
+			if sent, _ := resultGauge(t, result, "probe_websocket_pings_sent"); sent != float64(tc.settings.Count) {
+				t.Errorf("probe_websocket_pings_sent = %v, want %d", sent, tc.settings.Count)
+			}
+			if lost, _ := resultGauge(t, result, "probe_websocket_pongs_lost"); lost != tc.expectedLost {
+				t.Errorf("probe_websocket_pongs_lost = %v, want %v", lost, tc.expectedLost)
+			}
+
+			stats := labeledGauges(t, result, "probe_websocket_ping_rtt_seconds", "stat")
+			if !tc.expectedRTT {
+				if len(stats) != 0 {
+					t.Errorf("probe_websocket_ping_rtt_seconds = %v, want no series", stats)
+				}
+				return
+			}
+			if len(stats) != 4 {
+				t.Fatalf("probe_websocket_ping_rtt_seconds = %v, want min, avg, max and stddev", stats)
+			}
+			if stats["min"] < delay.Seconds() || stats["min"] > stats["avg"] || stats["avg"] > stats["max"] {
+				t.Errorf("probe_websocket_ping_rtt_seconds = %v, want min >= %s and min <= avg <= max", stats, delay)
+			}
+		})
+	}
+}
+
+// TestReportPingRTT tests the round trip time statistics
+func TestReportPingRTT(t *testing.T) {
+	var result probeResult
+	reportPingRTT([]time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}, 4, 1, &result)
+
+	expected := map[string]float64{"min": 0.1, "avg": 0.2, "max": 0.3, "stddev": 0.08165}
+	stats := labeledGauges(t, result, "probe_websocket_ping_rtt_seconds", "stat")
+	for stat, value := range expected {
+		if math.Abs(stats[stat]-value) > 1e-5 {
+			t.Errorf("probe_websocket_ping_rtt_seconds{stat=%q} = %v, want %v", stat, stats[stat], value)
+		}
+	}
+	if lost, _ := resultGauge(t, result, "probe_websocket_pongs_lost"); lost != 1 {
+		t.Errorf("probe_websocket_pongs_lost = %v, want 1", lost)
+	}
+}
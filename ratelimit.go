@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimitCode is the JSON-RPC error code providers such as Infura return
+// when a request exceeds the rate limit.
+const rateLimitCode = -32005
+
+// isRateLimitError reports whether err is the target refusing a request
+// because of rate limits, as opposed to failing it.
+func isRateLimitError(err error) bool {
+	// Providers use various codes, but tell it in the message. XRPL servers
+	// return a slowDown error. Only the messages of the target are looked
+	// at, since the wrapping context can mention anything.
+	var (
+		rpcErr  *rpcError
+		xrplErr *xrplError
+		message string
+	)
+	switch {
+	case errors.As(err, &rpcErr):
+		if rpcErr.Code == rateLimitCode {
+			return true
+		}
+		message = rpcErr.Message
+	case errors.As(err, &xrplErr):
+		message = xrplErr.Code + " " + xrplErr.Message
+	default:
+		return false
+	}
+	message = strings.ToLower(message)
+	return strings.Contains(message, "rate limit") || strings.Contains(message, "slowdown")
+}
+
+// parseRetryAfter parses a Retry-After header, given either as a number of
+// seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// setRateLimited records that the target throttled the probe. The probe
+// fails with the rate_limited reason, unless the module ignores rate limits.
+func (r *probeResult) setRateLimited(module Module, header http.Header) {
+	r.RateLimited = true
+	if header != nil {
+		if delay, ok := parseRetryAfter(header.Get("Retry-After"), time.Now()); ok {
+			r.setGauge("probe_rate_limit_retry_after_seconds", "Delay advertised by the target in the Retry-After header of a rate limited handshake", delay.Seconds())
+		}
+	}
+	if module.IgnoreRateLimits {
+		r.Success = true
+		r.FailedDueTo = ""
+		return
+	}
+	r.FailedDueTo = "rate_limited"
+}
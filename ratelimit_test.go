@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseRetryAfter tests both forms of the Retry-After header
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name       string
+		value      string
+		expected   time.Duration
+		expectedOK bool
+	}{
+		{name: "Seconds", value: "30", expected: 30 * time.Second, expectedOK: true},
+		{name: "HTTP date", value: "Wed, 01 Jan 2025 12:01:00 GMT", expected: time.Minute, expectedOK: true},
+		{name: "Date in the past", value: "Wed, 01 Jan 2025 11:00:00 GMT", expected: 0, expectedOK: true},
+		{name: "Missing", value: ""},
+		{name: "Negative", value: "-5"},
+		{name: "Invalid", value: "soon"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tc.value, now)
+			if ok != tc.expectedOK || got != tc.expected {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tc.value, got, ok, tc.expected, tc.expectedOK)
+			}
+		})
+	}
+}
+
+// TestIsRateLimitError tests the detection of in-band rate limit errors
+func TestIsRateLimitError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "Limit exceeded code",
+			err:      fmt.Errorf("error fetching chain ID: %w", &rpcError{Code: rateLimitCode, Message: "daily request count exceeded"}),
+			expected: true,
+		},
+		{
+			name:     "Rate limit message",
+			err:      &rpcError{Code: 429, Message: "Your app has exceeded its compute units per second capacity. Rate limit exceeded"},
+			expected: true,
+		},
+		{
+			name:     "XRPL slowDown",
+			err:      &xrplError{Command: "server_info", Code: "slowDown", Message: "You are placing too much load on the server."},
+			expected: true,
+		},
+		{
+			name: "Assertion mentioning rate limits",
+			err:  assertionf("message matched regexp %q", "rate limit"),
+		},
+		{
+			name: "Other JSON-RPC error",
+			err:  &rpcError{Code: -32601, Message: "method not found"},
+		},
+		{
+			name: "Assertion",
+			err:  assertionf("node is syncing"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRateLimitError(tc.err); got != tc.expected {
+				t.Errorf("isRateLimitError(%v) = %v, want %v", tc.err, got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestProbeWebSocketRateLimited tests rate limiting at handshake time and in
+// JSON-RPC responses, with and without ignore_rate_limits
+func TestProbeWebSocketRateLimited(t *testing.T) {
+	throttled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	}))
+	t.Cleanup(throttled.Close)
+	throttledURL := "ws" + strings.TrimPrefix(throttled.URL, "http")
+
+	quotaExceeded := newRPCServer(t, func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		return nil, &rpcError{Code: rateLimitCode, Message: "daily request count exceeded, request rate limited"}, nil
+	})
+	throttledRequest := newNullIDServer(t, &rpcError{Code: rateLimitCode, Message: "too many requests"})
+	methodNotFound := newRPCServer(t, func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	})
+
+	testCases := []struct {
+		name               string
+		target             string
+		module             Module
+		expectedSuccess    bool
+		expectedReason     string
+		expectedLimited    bool
+		expectedRetryAfter float64
+	}{
+		{
+			name:               "Handshake rejected with 429",
+			target:             throttledURL,
+			module:             Module{Prober: "websocket"},
+			expectedReason:     "rate_limited",
+			expectedLimited:    true,
+			expectedRetryAfter: 30,
+		},
+		{
+			name:               "Handshake rejected with 429 and rate limits ignored",
+			target:             throttledURL,
+			module:             Module{Prober: "websocket", IgnoreRateLimits: true},
+			expectedSuccess:    true,
+			expectedLimited:    true,
+			expectedRetryAfter: 30,
+		},
+		{
+			name:            "JSON-RPC limit exceeded",
+			target:          quotaExceeded,
+			module:          Module{Prober: "ethereum"},
+			expectedReason:  "rate_limited",
+			expectedLimited: true,
+		},
+		{
+			name:            "JSON-RPC limit exceeded without request id",
+			target:          throttledRequest,
+			module:          Module{Prober: "ethereum"},
+			expectedReason:  "rate_limited",
+			expectedLimited: true,
+		},
+		{
+			name:            "JSON-RPC limit exceeded and rate limits ignored",
+			target:          quotaExceeded,
+			module:          Module{Prober: "ethereum", IgnoreRateLimits: true},
+			expectedSuccess: true,
+			expectedLimited: true,
+		},
+		{
+			name:           "Other JSON-RPC error with rate limits ignored",
+			target:         methodNotFound,
+			module:         Module{Prober: "ethereum", IgnoreRateLimits: true},
+			expectedReason: "protocol",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := probeWebSocket(context.Background(), tc.target, "", tc.module)
+			if result.Success != tc.expectedSuccess {
+				t.Errorf("Success = %v, want %v", result.Success, tc.expectedSuccess)
+			}
+			if result.FailedDueTo != tc.expectedReason {
+				t.Errorf("FailedDueTo = %q, want %q", result.FailedDueTo, tc.expectedReason)
+			}
+			if got, _ := resultGauge(t, result, "probe_rate_limited"); got != boolToFloat64(tc.expectedLimited) {
+				t.Errorf("probe_rate_limited = %v, want %v", got, boolToFloat64(tc.expectedLimited))
+			}
+			got, ok := resultGauge(t, result, "probe_rate_limit_retry_after_seconds")
+			if ok != (tc.expectedRetryAfter > 0) || got != tc.expectedRetryAfter {
+				t.Errorf("probe_rate_limit_retry_after_seconds = %v (exported: %v), want %v", got, ok, tc.expectedRetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// redactedValue replaces the redacted parts of a URL.
+const redactedValue = "REDACTED"
+
+// Redaction hides credentials embedded in target URLs, such as provider API
+// keys in the path, wherever a target is logged.
+type Redaction struct {
+	// Userinfo hides the user and password of URLs. It is enabled unless
+	// explicitly set to false, in which case only the password is hidden.
+	Userinfo *bool `yaml:"userinfo,omitempty"`
+	// QueryParams lists the query parameters whose values are hidden.
+	QueryParams []string `yaml:"query_params,omitempty"`
+	// PathSegments hides every path segment matching one of the regexps.
+	PathSegments []Regexp `yaml:"path_segments,omitempty"`
+}
+
+// redact returns u as a string with the configured parts replaced.
+func (r Redaction) redact(u *url.URL) string {
+	redacted := *u
+
+	if u.User != nil {
+		if r.Userinfo == nil || *r.Userinfo {
+			redacted.User = url.User(redactedValue)
+		} else if _, ok := u.User.Password(); ok {
+			redacted.User = url.UserPassword(u.User.Username(), redactedValue)
+		}
+	}
+
+	if len(r.QueryParams) > 0 && u.RawQuery != "" {
+		query := u.Query()
+		for _, param := range r.QueryParams {
+			if query.Has(param) {
+				query.Set(param, redactedValue)
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+
+	if len(r.PathSegments) > 0 {
+		segments := strings.Split(u.Path, "/")
+		for i, segment := range segments {
+			for _, re := range r.PathSegments {
+				if segment != "" && re.MatchString(segment) {
+					segments[i] = redactedValue
+					break
+				}
+			}
+		}
+		redacted.Path = strings.Join(segments, "/")
+		redacted.RawPath = ""
+	}
+
+	return redacted.String()
+}
+
+// redactTarget formats a target for the logs with the active redaction rules.
+// Targets that are not valid URLs are not printed at all, since they cannot be
+// redacted reliably.
+func redactTarget(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return safeConfig.redaction().redact(u)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scriptData is the data available to the templates of a script step.
+type scriptData struct {
+	// RequestID is a random ID, fresh for every step, to correlate a sent
+	// frame with the expected response.
+	RequestID string
+	// Timestamp is the current Unix time in seconds.
+	Timestamp int64
+}
+
+// probeScript runs the ordered send/expect steps of a module on the
+// connection. Every step is exported with its success and duration, and the
+// first failing step fails the probe.
+func probeScript(ctx context.Context, c *probeConn, module Module, result *probeResult) error {
+	steps := module.Script.Steps
+	succeeded := make([]bool, len(steps))
+	durations := make([]time.Duration, len(steps))
+	defer func() {
+		for i, step := range steps {
+			labels := prometheus.Labels{"step": step.Name}
+			result.setLabeledGauge("probe_script_step_success", "Whether the script step succeeded", labels, boolToFloat64(succeeded[i]))
+			result.setLabeledGauge("probe_script_step_duration_seconds", "Duration of the script step", labels, durations[i].Seconds())
+		}
+	}()
+
+	deadline, _ := ctx.Deadline()
+	if err := c.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+
+	for i, step := range steps {
+		stepStart := time.Now()
+		err := runScriptStep(c, step, deadline)
+		durations[i] = time.Since(stepStart)
+		if err != nil {
+			return fmt.Errorf("step %q failed: %w", step.Name, err)
+		}
+		succeeded[i] = true
+	}
+	return nil
+}
+
+// runScriptStep sends the frame of a step and waits for the expected one.
+func runScriptStep(c *probeConn, step ScriptStep, deadline time.Time) error {
+	data := scriptData{
+		RequestID: strconv.FormatUint(uint64(rand.Uint32()), 10),
+		Timestamp: time.Now().Unix(),
+	}
+
+	if step.Send.Template != nil {
+		var frame bytes.Buffer
+		if err := step.Send.Execute(&frame, data); err != nil {
+			return fmt.Errorf("error rendering frame: %w", err)
+		}
+		messageType := websocket.TextMessage
+		if step.Binary {
+			messageType = websocket.BinaryMessage
+		}
+		if err := c.WriteMessage(messageType, frame.Bytes()); err != nil {
+			return fmt.Errorf("error sending frame: %w", err)
+		}
+	}
+
+	if step.Expect == nil {
+		return nil
+	}
+	expect := step.Expect
+
+	readDeadline := deadline
+	if expect.Timeout > 0 {
+		stepDeadline := time.Now().Add(expect.Timeout)
+		if readDeadline.IsZero() || stepDeadline.Before(readDeadline) {
+			readDeadline = stepDeadline
+		}
+	}
+	if err := c.SetReadDeadline(readDeadline); err != nil {
+		return err
+	}
+
+	for {
+		_, frame, err := c.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("no matching frame received: %w", err)
+		}
+		err = expect.check(frame, data)
+		if err == nil {
+			return nil
+		}
+		if !expect.SkipNonMatching {
+			return err
+		}
+	}
+}
+
+// check applies the assertions of an expectation to a received frame.
+func (e *ScriptExpect) check(frame []byte, data scriptData) error {
+	for _, re := range e.Regexp {
+		if !re.Match(frame) {
+			return assertionf("frame did not match regexp %q", re.String())
+		}
+	}
+	if len(e.JSONPath) == 0 {
+		return nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(frame, &document); err != nil {
+		return fmt.Errorf("frame is not valid JSON: %w", err)
+	}
+	for _, assertion := range e.JSONPath {
+		if err := assertion.check(document, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check applies the assertion to a decoded JSON document.
+func (a JSONPathAssertion) check(document interface{}, data scriptData) error {
+	// A missing value is a frame that does not match, not a protocol error
+	value, err := a.Path.lookup(document)
+	if err != nil {
+		return assertionf("%v", err)
+	}
+	actual := jsonValueString(value)
+	if a.Equals.Template != nil {
+		var expected bytes.Buffer
+		if err := a.Equals.Execute(&expected, data); err != nil {
+			return fmt.Errorf("error rendering expected value: %w", err)
+		}
+		if actual != expected.String() {
+			return assertionf("%s is %q, expected %q", a.Path, actual, expected.String())
+		}
+	}
+	if a.Regexp.Regexp != nil && !a.Regexp.MatchString(actual) {
+		return assertionf("%s is %q, which does not match regexp %q", a.Path, actual, a.Regexp.String())
+	}
+	return nil
+}
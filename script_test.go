@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// loadModule parses a single module named test from a YAML snippet
+func loadModule(t *testing.T, content string) Module {
+	t.Helper()
+	cfg, err := loadConfig(writeConfig(t, "modules:\n  test:\n"+content))
+	if err != nil {
+		t.Fatalf("loadConfig() unexpected error: %v", err)
+	}
+	return cfg.Modules["test"]
+}
+
+// TestProbeScript tests the send/expect steps of the script prober
+func TestProbeScript(t *testing.T) {
+	url := newRPCServer(t, func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		switch method {
+		case "eth_blockNumber":
+			return "0x10", nil, nil
+		case "eth_subscribe":
+			return "0xsub", nil, []interface{}{
+				rpcNotification("eth_subscription", map[string]interface{}{"subscription": "0xother", "result": map[string]string{"number": "0x1"}}),
+				rpcNotification("eth_subscription", map[string]interface{}{"subscription": "0xsub", "result": map[string]string{"number": "0x11"}}),
+			}
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	})
+
+	testCases := []struct {
+		name          string
+		module        string
+		expected      bool
+		expectedSteps string
+	}{
+		{
+			name: "Request and subscription",
+			module: `
+    prober: script
+    timeout: 2s
+    script:
+      steps:
+        - name: block_number
+          send: '{"jsonrpc":"2.0","id":{{ .RequestID }},"method":"eth_blockNumber","params":[]}'
+          expect:
+            jsonpath:
+              - path: $.id
+                equals: '{{ .RequestID }}'
+              - path: $.result
+                regexp: '^0x[0-9a-f]+$'
+        - name: subscribe
+          send: '{"jsonrpc":"2.0","id":2,"method":"eth_subscribe","params":["newHeads"]}'
+          expect:
+            regexp: ['"result":"0xsub"']
+        - name: first_head
+          expect:
+            timeout: 500ms
+            skip_non_matching: true
+            jsonpath:
+              - path: $.params.subscription
+                equals: 0xsub
+              - path: $.params.result.number
+`,
+			expected: true,
+			expectedSteps: `
+probe_script_step_success{step="block_number"} 1
+probe_script_step_success{step="first_head"} 1
+probe_script_step_success{step="subscribe"} 1
+`,
+		},
+		{
+			name: "Failing assertion stops the script",
+			module: `
+    prober: script
+    timeout: 2s
+    script:
+      steps:
+        - name: block_number
+          send: '{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}'
+          expect:
+            jsonpath:
+              - path: $.error
+        - name: never_run
+          send: '{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber","params":[]}'
+`,
+			expected: false,
+			expectedSteps: `
+probe_script_step_success{step="block_number"} 0
+probe_script_step_success{step="never_run"} 0
+`,
+		},
+		{
+			name: "Unexpected frame without skipping",
+			module: `
+    prober: script
+    timeout: 2s
+    script:
+      steps:
+        - name: subscribe
+          send: '{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}'
+          expect:
+            jsonpath:
+              - path: $.params.subscription
+`,
+			expected: false,
+			expectedSteps: `
+probe_script_step_success{step="subscribe"} 0
+`,
+		},
+		{
+			name: "Expected frame never arrives",
+			module: `
+    prober: script
+    timeout: 2s
+    script:
+      steps:
+        - name: silence
+          expect:
+            timeout: 100ms
+`,
+			expected: false,
+			expectedSteps: `
+probe_script_step_success{step="silence"} 0
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := probeWebSocket(context.Background(), url, "", loadModule(t, tc.module))
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(result.collectors()...)
+			expected := `
+# HELP probe_script_step_success Whether the script step succeeded
+# TYPE probe_script_step_success gauge
+` + strings.TrimPrefix(tc.expectedSteps, "\n")
+			if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "probe_script_step_success"); err != nil {
+				t.Errorf("unexpected probe_script_step_success: %v", err)
+			}
+		})
+	}
+}
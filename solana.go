@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// solanaSlot is the result of a slotNotification.
+type solanaSlot struct {
+	Slot   uint64 `json:"slot"`
+	Parent uint64 `json:"parent"`
+	Root   uint64 `json:"root"`
+}
+
+// probeSolana fetches the current slot with getSlot, then subscribes to slot
+// updates and checks that they keep coming. When an observation window is
+// configured, notifications are collected for that long to measure how fast
+// the slot advances.
+func probeSolana(ctx context.Context, c *probeConn, module Module, result *probeResult) error {
+	settings := module.Solana
+	client, err := newRPCClient(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	// slotSubscribe is the last request, since slot notifications queued
+	// while waiting for another response would be timed when dequeued
+	var rpcSlot uint64
+	if err := client.call("getSlot", nil, &rpcSlot); err != nil {
+		return err
+	}
+	result.setGauge("probe_solana_rpc_slot", "Slot reported by getSlot", float64(rpcSlot))
+
+	var rootSubscription json.RawMessage
+	if settings.RootSubscribe {
+		if rootSubscription, err = client.subscribe("rootSubscribe", nil); err != nil {
+			return err
+		}
+	}
+
+	subscribeStart := time.Now()
+	slotSubscription, err := client.subscribe("slotSubscribe", nil)
+	if err != nil {
+		return err
+	}
+	ackTime := time.Now()
+	result.setGauge("probe_solana_subscription_ack_duration_seconds", "Time until the slotSubscribe request was acknowledged with a subscription ID", ackTime.Sub(subscribeStart).Seconds())
+
+	var (
+		firstSlot, lastSlot         solanaSlot
+		firstSlotTime, lastSlotTime time.Time
+		slots                       int
+		root                        uint64
+		rootReceived                = !settings.RootSubscribe
+	)
+	for {
+		done := slots > 0 && rootReceived && time.Since(firstSlotTime) >= settings.ObservationWindow
+		if done {
+			break
+		}
+
+		subscription, data, err := client.nextSubscriptionNotification()
+		if err != nil {
+			// The end of the observation window is reached through the read
+			// deadline, so a timeout is expected once the slots are in
+			if slots > 0 && rootReceived {
+				break
+			}
+			if slots == 0 {
+				return fmt.Errorf("no slot notification received: %w", err)
+			}
+			return fmt.Errorf("no root notification received: %w", err)
+		}
+
+		switch {
+		case bytes.Equal(subscription, slotSubscription):
+			var slot solanaSlot
+			if err := json.Unmarshal(data, &slot); err != nil {
+				return fmt.Errorf("invalid slot notification: %w", err)
+			}
+			if slots == 0 {
+				firstSlot, firstSlotTime = slot, time.Now()
+				result.setGauge("probe_solana_first_slot_duration_seconds", "Time from the subscription acknowledgement to the first slot notification", firstSlotTime.Sub(ackTime).Seconds())
+				if settings.ObservationWindow > 0 {
+					if err := client.setReadTimeout(settings.ObservationWindow); err != nil {
+						return err
+					}
+				}
+			}
+			lastSlot, lastSlotTime = slot, time.Now()
+			slots++
+		case rootSubscription != nil && bytes.Equal(subscription, rootSubscription):
+			if err := json.Unmarshal(data, &root); err != nil {
+				return fmt.Errorf("invalid root notification: %w", err)
+			}
+			rootReceived = true
+		}
+	}
+
+	result.setGauge("probe_solana_slot", "Latest slot received through slotSubscribe", float64(lastSlot.Slot))
+	if settings.RootSubscribe {
+		result.setGauge("probe_solana_root", "Root slot received through rootSubscribe", float64(root))
+	}
+	if elapsed := lastSlotTime.Sub(firstSlotTime); slots > 1 && elapsed > 0 {
+		rate := (float64(lastSlot.Slot) - float64(firstSlot.Slot)) / elapsed.Seconds()
+		result.setGauge("probe_solana_slot_rate", "Slots advanced per second over the observation window", rate)
+	}
+	return nil
+}
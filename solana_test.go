@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// solanaSlotNotification builds a slotNotification for subscription
+func solanaSlotNotification(subscription int, slot uint64) interface{} {
+	return rpcNotification("slotNotification", map[string]interface{}{
+		"subscription": subscription,
+		"result":       map[string]uint64{"slot": slot, "parent": slot - 1, "root": slot - 32},
+	})
+}
+
+// solanaHandler answers getSlot, slotSubscribe and rootSubscribe, sending the
+// given notifications after each subscription
+func solanaHandler(slotNotifications []interface{}, rootNotifications []interface{}) rpcHandler {
+	return func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		switch method {
+		case "getSlot":
+			return 999, nil, nil
+		case "slotSubscribe":
+			return 7, nil, slotNotifications
+		case "rootSubscribe":
+			return 8, nil, rootNotifications
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	}
+}
+
+// TestProbeSolana tests the getSlot, slotSubscribe and rootSubscribe checks
+func TestProbeSolana(t *testing.T) {
+	steadySlots := []interface{}{
+		solanaSlotNotification(7, 1000),
+		100 * time.Millisecond,
+		solanaSlotNotification(7, 1001),
+		100 * time.Millisecond,
+		solanaSlotNotification(7, 1002),
+	}
+
+	testCases := []struct {
+		name         string
+		handler      rpcHandler
+		settings     SolanaProbe
+		expected     bool
+		expectedSlot float64
+		expectRate   bool
+		expectRoot   bool
+	}{
+		{
+			name:         "First slot only",
+			handler:      solanaHandler(steadySlots, nil),
+			expected:     true,
+			expectedSlot: 1000,
+		},
+		{
+			name:         "Slot rate over observation window",
+			handler:      solanaHandler(steadySlots, nil),
+			settings:     SolanaProbe{ObservationWindow: 300 * time.Millisecond},
+			expected:     true,
+			expectedSlot: 1002,
+			expectRate:   true,
+		},
+		{
+			name: "Root subscription",
+			handler: solanaHandler(
+				[]interface{}{solanaSlotNotification(7, 1000)},
+				[]interface{}{rpcNotification("rootNotification", map[string]interface{}{"subscription": 8, "result": 968})},
+			),
+			settings:     SolanaProbe{RootSubscribe: true},
+			expected:     true,
+			expectedSlot: 1000,
+			expectRoot:   true,
+		},
+		{
+			name:     "Root never received",
+			handler:  solanaHandler([]interface{}{solanaSlotNotification(7, 1000)}, nil),
+			settings: SolanaProbe{RootSubscribe: true},
+			expected: false,
+		},
+		{
+			name:     "No slot notification",
+			handler:  solanaHandler(nil, nil),
+			expected: false,
+		},
+		{
+			name: "getSlot failing",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				if method == "getSlot" {
+					return nil, &rpcError{Code: -32603, Message: "internal error"}, nil
+				}
+				return solanaHandler([]interface{}{solanaSlotNotification(7, 1000)}, nil)(method, params)
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := newRPCServer(t, tc.handler)
+			module := Module{Prober: "solana", Timeout: time.Second, Solana: tc.settings}
+
+			result := probeWebSocket(context.Background(), url, "", module)
+			if result.Success != tc.expected {
+				t.Fatalf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if !tc.expected {
+				return
+			}
+
+			if value, _ := resultGauge(t, result, "probe_solana_slot"); value != tc.expectedSlot {
+				t.Errorf("probe_solana_slot = %v, want %v", value, tc.expectedSlot)
+			}
+			if value, _ := resultGauge(t, result, "probe_solana_rpc_slot"); value != 999 {
+				t.Errorf("probe_solana_rpc_slot = %v, want 999", value)
+			}
+			for _, name := range []string{"probe_solana_subscription_ack_duration_seconds", "probe_solana_first_slot_duration_seconds"} {
+				if value, ok := resultGauge(t, result, name); !ok || value <= 0 {
+					t.Errorf("%s = %v, want > 0", name, value)
+				}
+			}
+			rate, ok := resultGauge(t, result, "probe_solana_slot_rate")
+			if ok != tc.expectRate {
+				t.Errorf("probe_solana_slot_rate exported = %v, want %v", ok, tc.expectRate)
+			}
+			if ok && (rate < 5 || rate > 15) {
+				t.Errorf("probe_solana_slot_rate = %v, want about 10", rate)
+			}
+			if root, ok := resultGauge(t, result, "probe_solana_root"); ok != tc.expectRoot || (ok && root != 968) {
+				t.Errorf("probe_solana_root = %v (exported %v), want 968 (exported %v)", root, ok, tc.expectRoot)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// substrateHealth is the result of system_health.
+type substrateHealth struct {
+	Peers           int  `json:"peers"`
+	IsSyncing       bool `json:"isSyncing"`
+	ShouldHavePeers bool `json:"shouldHavePeers"`
+}
+
+// substrateHeader is the part of a Substrate header the prober looks at.
+type substrateHeader struct {
+	Number string `json:"number"`
+}
+
+// probeSubstrate checks the health of a Substrate/Polkadot node and waits for
+// its first best and finalized heads.
+func probeSubstrate(ctx context.Context, c *probeConn, module Module, result *probeResult) error {
+	settings := module.Substrate
+	client, err := newRPCClient(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	var health substrateHealth
+	if err := client.call("system_health", nil, &health); err != nil {
+		return err
+	}
+	result.setGauge("probe_substrate_peers", "Number of peers reported by system_health", float64(health.Peers))
+	result.setGauge("probe_substrate_syncing", "Whether system_health reports that the node is syncing", boolToFloat64(health.IsSyncing))
+
+	newHeads, err := client.subscribe("chain_subscribeNewHeads", nil)
+	if err != nil {
+		return err
+	}
+	finalizedHeads, err := client.subscribe("chain_subscribeFinalizedHeads", nil)
+	if err != nil {
+		return err
+	}
+
+	var best, finalized *uint64
+	for best == nil || finalized == nil {
+		subscription, data, err := client.nextSubscriptionNotification()
+		if err != nil {
+			return fmt.Errorf("no best and finalized heads received: %w", err)
+		}
+
+		var target **uint64
+		switch {
+		case bytes.Equal(subscription, newHeads):
+			target = &best
+		case bytes.Equal(subscription, finalizedHeads):
+			target = &finalized
+		default:
+			continue
+		}
+
+		var header substrateHeader
+		if err := json.Unmarshal(data, &header); err != nil {
+			return fmt.Errorf("invalid header notification: %w", err)
+		}
+		number, err := parseHexUint64(header.Number)
+		if err != nil {
+			return fmt.Errorf("invalid header number: %w", err)
+		}
+		*target = &number
+	}
+
+	gap := float64(*best) - float64(*finalized)
+	result.setGauge("probe_substrate_best_block_number", "Block number of the first chain_subscribeNewHeads notification", float64(*best))
+	result.setGauge("probe_substrate_finalized_block_number", "Block number of the first chain_subscribeFinalizedHeads notification", float64(*finalized))
+	result.setGauge("probe_substrate_finality_gap_blocks", "Number of blocks between the best and the finalized head", gap)
+
+	if settings.FailIfSyncing && health.IsSyncing {
+		return assertionf("node is syncing")
+	}
+	if health.ShouldHavePeers && health.Peers < settings.MinPeers {
+		return assertionf("node has %d peers, fewer than the required %d", health.Peers, settings.MinPeers)
+	}
+	if settings.MaxFinalityGap > 0 && gap > float64(settings.MaxFinalityGap) {
+		return assertionf("finalized head is %.0f blocks behind the best head, more than the allowed %d", gap, settings.MaxFinalityGap)
+	}
+	return nil
+}
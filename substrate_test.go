@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// substrateHeadNotification builds a header notification for subscription
+func substrateHeadNotification(method, subscription string, number uint64) interface{} {
+	return rpcNotification(method, map[string]interface{}{
+		"subscription": subscription,
+		"result":       map[string]string{"number": "0x" + strconv.FormatUint(number, 16), "parentHash": "0x00"},
+	})
+}
+
+// substrateHandler answers system_health and the head subscriptions
+func substrateHandler(health substrateHealth, best, finalized uint64) rpcHandler {
+	return func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		switch method {
+		case "system_health":
+			return health, nil, nil
+		case "chain_subscribeNewHeads":
+			return "best-sub", nil, []interface{}{substrateHeadNotification("chain_newHead", "best-sub", best)}
+		case "chain_subscribeFinalizedHeads":
+			return "finalized-sub", nil, []interface{}{substrateHeadNotification("chain_finalizedHead", "finalized-sub", finalized)}
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+	}
+}
+
+// TestProbeSubstrate tests the system_health and head subscription checks
+func TestProbeSubstrate(t *testing.T) {
+	healthy := substrateHealth{Peers: 40, IsSyncing: false, ShouldHavePeers: true}
+
+	testCases := []struct {
+		name     string
+		handler  rpcHandler
+		settings SubstrateProbe
+		expected bool
+	}{
+		{
+			name:     "Healthy node",
+			handler:  substrateHandler(healthy, 1002, 1000),
+			settings: SubstrateProbe{FailIfSyncing: true, MinPeers: 10, MaxFinalityGap: 5},
+			expected: true,
+		},
+		{
+			name:     "Syncing node",
+			handler:  substrateHandler(substrateHealth{Peers: 40, IsSyncing: true, ShouldHavePeers: true}, 1002, 1000),
+			settings: SubstrateProbe{FailIfSyncing: true},
+			expected: false,
+		},
+		{
+			name:     "Too few peers",
+			handler:  substrateHandler(substrateHealth{Peers: 2, ShouldHavePeers: true}, 1002, 1000),
+			settings: SubstrateProbe{MinPeers: 10},
+			expected: false,
+		},
+		{
+			name:     "Dev chain without peers",
+			handler:  substrateHandler(substrateHealth{Peers: 0, ShouldHavePeers: false}, 1002, 1000),
+			settings: SubstrateProbe{MinPeers: 10},
+			expected: true,
+		},
+		{
+			name:     "Finality stalled",
+			handler:  substrateHandler(healthy, 1100, 1000),
+			settings: SubstrateProbe{MaxFinalityGap: 5},
+			expected: false,
+		},
+		{
+			name: "Finalized heads not supported",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				if method == "chain_subscribeFinalizedHeads" {
+					return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+				}
+				return substrateHandler(healthy, 1002, 1000)(method, params)
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := newRPCServer(t, tc.handler)
+			module := Module{Prober: "substrate", Timeout: time.Second, Substrate: tc.settings}
+
+			result := probeWebSocket(context.Background(), url, "", module)
+			if result.Success != tc.expected {
+				t.Errorf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if tc.name != "Healthy node" {
+				return
+			}
+
+			expectedGauges := map[string]float64{
+				"probe_substrate_peers":                  40,
+				"probe_substrate_syncing":                0,
+				"probe_substrate_best_block_number":      1002,
+				"probe_substrate_finalized_block_number": 1000,
+				"probe_substrate_finality_gap_blocks":    2,
+			}
+			for name, expected := range expectedGauges {
+				if value, _ := resultGauge(t, result, name); value != expected {
+					t.Errorf("%s = %v, want %v", name, value, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TargetsConfig maps target aliases to the targets they stand for, so that
+// URLs carrying API keys only live in a file on the exporter side.
+type TargetsConfig struct {
+	Targets map[string]Target `yaml:"targets"`
+}
+
+// Target is the URL behind an alias, with the settings used to probe it.
+type Target struct {
+	URL string `yaml:"url"`
+	// Module is used when the scrape does not name a module.
+	Module string `yaml:"module,omitempty"`
+	// Headers are added to the module headers, overriding them.
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface. A target is
+// either a URL or a mapping. The fields of the mapping are checked by hand,
+// since the decoder does not enforce known fields inside custom unmarshalers.
+func (t *Target) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&t.URL)
+	}
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i < len(value.Content); i += 2 {
+			switch key := value.Content[i].Value; key {
+			case "url", "module", "headers":
+			default:
+				return fmt.Errorf("line %d: field %s not found in type main.Target", value.Content[i].Line, key)
+			}
+		}
+	}
+	type plain Target
+	return value.Decode((*plain)(t))
+}
+
+// loadTargets reads, parses and validates the targets file at path. The
+// target modules must exist in cfg.
+func loadTargets(path string, cfg *Config) (*TargetsConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading targets file: %w", err)
+	}
+
+	targets := &TargetsConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(targets); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing targets file: %w", err)
+	}
+
+	// Errors name the alias only, since the URL is the secret being protected
+	for alias, target := range targets.Targets {
+		if alias == "" || strings.Contains(alias, "://") {
+			return nil, fmt.Errorf("invalid target alias %q", alias)
+		}
+		targetURL, err := url.Parse(target.URL)
+		if err != nil || (targetURL.Scheme != "ws" && targetURL.Scheme != "wss") {
+			return nil, fmt.Errorf("target %q must be a ws or wss URL", alias)
+		}
+		if _, ok := cfg.Modules[target.Module]; target.Module != "" && !ok {
+			return nil, fmt.Errorf("target %q: unknown module %q", alias, target.Module)
+		}
+		for name := range target.Headers {
+			if name == "" {
+				return nil, fmt.Errorf("target %q: header names must not be empty", alias)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// isAlias reports whether a scrape target refers to an alias rather than a
+// URL.
+func isAlias(target string) bool {
+	return !strings.Contains(target, "://")
+}
+
+// SafeTargets guards the active target aliases so they can be reloaded while
+// probes are running.
+type SafeTargets struct {
+	sync.RWMutex
+	C *TargetsConfig
+}
+
+// safeTargets holds the aliases resolved by probeHandler.
+var safeTargets = &SafeTargets{C: &TargetsConfig{}}
+
+// target looks up an alias.
+func (st *SafeTargets) target(alias string) (Target, bool) {
+	st.RLock()
+	defer st.RUnlock()
+	target, ok := st.C.Targets[alias]
+	return target, ok
+}
+
+// set replaces the active target aliases.
+func (st *SafeTargets) set(cfg *TargetsConfig) {
+	st.Lock()
+	defer st.Unlock()
+	st.C = cfg
+}
+
+// withHeaders returns a copy of the module with extra upgrade request
+// headers. The header map is copied, since it is shared with the config.
+func (m Module) withHeaders(headers map[string]string) Module {
+	if len(headers) == 0 {
+		return m
+	}
+	merged := make(map[string]string, len(m.WebSocket.Headers)+len(headers))
+	for name, value := range m.WebSocket.Headers {
+		merged[name] = value
+	}
+	for name, value := range headers {
+		merged[name] = value
+	}
+	m.WebSocket.Headers = merged
+	return m
+}
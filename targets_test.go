@@ -0,0 +1,374 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// writeTargets writes a targets file to a temporary directory
+func writeTargets(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "targets.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write targets file: %v", err)
+	}
+	return path
+}
+
+// TestLoadTargets tests parsing and validation of the targets file
+func TestLoadTargets(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Modules["eth_blocknumber"] = Module{Prober: "ethereum"}
+
+	testCases := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name: "Valid targets",
+			content: `
+targets:
+  eth-mainnet-alchemy: wss://eth-mainnet.g.alchemy.com/v2/secret
+  local: ws://127.0.0.1:8546
+`,
+		},
+		{
+			name:    "Empty file",
+			content: "",
+		},
+		{
+			name: "Target with module and headers",
+			content: `
+targets:
+  eth-mainnet-alchemy:
+    url: wss://eth-mainnet.g.alchemy.com/v2/secret
+    module: eth_blocknumber
+    headers:
+      Origin: https://monitoring.example.com
+`,
+		},
+		{
+			name: "Unknown target module",
+			content: `
+targets:
+  eth-mainnet-alchemy:
+    url: wss://eth-mainnet.g.alchemy.com/v2/secret
+    module: eth_blocknumbr
+`,
+			expectedErr: `target "eth-mainnet-alchemy": unknown module "eth_blocknumbr"`,
+		},
+		{
+			name: "Unknown target field",
+			content: `
+targets:
+  broken:
+    url: wss://eth-mainnet.g.alchemy.com/v2/secret
+    modul: eth_blocknumber
+`,
+			expectedErr: "field modul not found",
+		},
+		{
+			name: "Alias that looks like a URL",
+			content: `
+targets:
+  "ws://node": wss://eth-mainnet.g.alchemy.com/v2/secret
+`,
+			expectedErr: `invalid target alias "ws://node"`,
+		},
+		{
+			name: "Not a WebSocket URL",
+			content: `
+targets:
+  broken: https://eth-mainnet.g.alchemy.com/v2/secret
+`,
+			expectedErr: `target "broken" must be a ws or wss URL`,
+		},
+		{
+			name: "Unknown field",
+			content: `
+tragets:
+  local: ws://127.0.0.1:8546
+`,
+			expectedErr: "field tragets not found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTargets(writeTargets(t, tc.content), cfg)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("loadTargets() error = %v, want error containing %q", err, tc.expectedErr)
+				}
+				if strings.Contains(err.Error(), "secret") {
+					t.Errorf("loadTargets() error %q contains the target URL", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadTargets() unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestProbeHandlerTargetAlias tests that probeHandler resolves target aliases
+// with their module and headers, and rejects unknown aliases
+func TestProbeHandlerTargetAlias(t *testing.T) {
+	url, lastHeader := newHeaderServer(t)
+
+	origConfig := safeConfig.C
+	cfg, err := loadConfig(writeConfig(t, `
+modules:
+  with_origin:
+    websocket:
+      headers:
+        Origin: https://module.example.com
+        X-Team: monitoring
+  failing:
+    websocket:
+      fail_if_not_matches_regexp: ['never sent']
+`))
+	if err != nil {
+		t.Fatalf("loadConfig() unexpected error: %v", err)
+	}
+	safeConfig.set(cfg)
+	defer safeConfig.set(origConfig)
+
+	origTargets := safeTargets.C
+	targets, err := loadTargets(writeTargets(t, `
+targets:
+  plain-node: `+url+`
+  dead-node: ws://127.0.0.1:1
+  custom-node:
+    url: `+url+`
+    module: with_origin
+    headers:
+      Origin: https://target.example.com
+`), cfg)
+	if err != nil {
+		t.Fatalf("loadTargets() unexpected error: %v", err)
+	}
+	safeTargets.set(targets)
+	defer safeTargets.set(origTargets)
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expected       string
+		expectedHeader map[string]string
+	}{
+		{
+			name:           "Alias",
+			query:          "target=plain-node",
+			expectedStatus: http.StatusOK,
+			expected:       "probe_success 1",
+		},
+		{
+			name:           "Alias of an unreachable node",
+			query:          "target=dead-node",
+			expectedStatus: http.StatusOK,
+			expected:       "probe_success 0",
+		},
+		{
+			name:           "Plain URL",
+			query:          "target=" + url,
+			expectedStatus: http.StatusOK,
+			expected:       "probe_success 1",
+		},
+		{
+			name:           "Target module and headers",
+			query:          "target=custom-node",
+			expectedStatus: http.StatusOK,
+			expected:       "probe_success 1",
+			expectedHeader: map[string]string{"Origin": "https://target.example.com", "X-Team": "monitoring"},
+		},
+		{
+			name:           "Module parameter overrides the target module",
+			query:          "target=custom-node&module=failing",
+			expectedStatus: http.StatusOK,
+			expected:       "probe_success 0",
+		},
+		{
+			name:           "Unknown alias",
+			query:          "target=missing-node",
+			expectedStatus: http.StatusBadRequest,
+			expected:       `Unknown target "missing-node"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			probeHandler(rec, httptest.NewRequest(http.MethodGet, "/probe?"+tc.query, nil))
+
+			body, _ := io.ReadAll(rec.Result().Body)
+			if rec.Code != tc.expectedStatus {
+				t.Fatalf("probeHandler() status = %d, want %d", rec.Code, tc.expectedStatus)
+			}
+			if !strings.Contains(string(body), tc.expected) {
+				t.Errorf("probeHandler() body does not contain %q:\n%s", tc.expected, body)
+			}
+			for name, value := range tc.expectedHeader {
+				if got := lastHeader().Get(name); got != value {
+					t.Errorf("%s header = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+
+	// The module headers in the config must not pick up the target ones
+	module, _ := safeConfig.module("with_origin")
+	if origin := module.WebSocket.Headers["Origin"]; origin != "https://module.example.com" {
+		t.Errorf("module Origin header = %q after probing, want it unchanged", origin)
+	}
+}
+
+// TestProbeHandlerTargetAliasLogs tests that the logs of an alias probe show
+// the alias instead of the URL it resolves to
+func TestProbeHandlerTargetAliasLogs(t *testing.T) {
+	url, _ := newHeaderServer(t)
+	const token = "abcdefghijklmnopqrstuvwxyz012345"
+
+	origTargets := safeTargets.C
+	targets, err := loadTargets(writeTargets(t, `
+targets:
+  live-node: `+url+`/v2/`+token+`
+  dead-node: ws://127.0.0.1:1/v2/`+token+`
+`), safeConfig.config())
+	if err != nil {
+		t.Fatalf("loadTargets() unexpected error: %v", err)
+	}
+	safeTargets.set(targets)
+	defer safeTargets.set(origTargets)
+
+	for _, alias := range []string{"live-node", "dead-node"} {
+		output := captureStdout(t, func() {
+			probeHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/probe?target="+alias, nil))
+		})
+		if !strings.Contains(output, alias) {
+			t.Errorf("probe of %s did not log the alias:\n%s", alias, output)
+		}
+		if strings.Contains(output, token) {
+			t.Errorf("probe of %s logged the resolved URL:\n%s", alias, output)
+		}
+	}
+}
+
+// TestReloadTargets tests that the targets file is reloaded through
+// /-/reload, checked against the reloaded modules, and kept when the new file
+// is invalid
+func TestReloadTargets(t *testing.T) {
+	origConfig, origTargets := safeConfig.C, safeTargets.C
+	origConfigFile, origTargetsFile := *configFile, *targetsFile
+	defer func() {
+		safeConfig.set(origConfig)
+		safeTargets.set(origTargets)
+		*configFile, *targetsFile = origConfigFile, origTargetsFile
+	}()
+
+	*configFile = writeConfig(t, "modules:\n  eth_blocknumber:\n    prober: ethereum\n")
+	*targetsFile = writeTargets(t, "targets:\n  first:\n    url: ws://127.0.0.1:8546\n    module: eth_blocknumber\n")
+
+	testCases := []struct {
+		name           string
+		config         string
+		targets        string
+		expectedStatus int
+		expectedTarget string
+	}{
+		{
+			name:           "Valid files",
+			expectedStatus: http.StatusOK,
+			expectedTarget: "first",
+		},
+		{
+			name:           "Invalid targets file",
+			targets:        "targets:\n  second: https://example.com\n",
+			expectedStatus: http.StatusInternalServerError,
+			expectedTarget: "first",
+		},
+		{
+			name:           "Module removed from the config file",
+			config:         "modules:\n  eth_newheads:\n    prober: ethereum\n",
+			targets:        "targets:\n  third:\n    url: ws://127.0.0.1:8546\n    module: eth_blocknumber\n",
+			expectedStatus: http.StatusInternalServerError,
+			expectedTarget: "first",
+		},
+		{
+			name:           "Module renamed in both files",
+			config:         "modules:\n  eth_newheads:\n    prober: ethereum\n",
+			targets:        "targets:\n  fourth:\n    url: ws://127.0.0.1:8546\n    module: eth_newheads\n",
+			expectedStatus: http.StatusOK,
+			expectedTarget: "fourth",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.config != "" {
+				if err := os.WriteFile(*configFile, []byte(tc.config), 0o600); err != nil {
+					t.Fatalf("Failed to write config file: %v", err)
+				}
+			}
+			if tc.targets != "" {
+				if err := os.WriteFile(*targetsFile, []byte(tc.targets), 0o600); err != nil {
+					t.Fatalf("Failed to write targets file: %v", err)
+				}
+			}
+
+			rr := httptest.NewRecorder()
+			reloadHandler(rr, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if _, ok := safeTargets.target(tc.expectedTarget); !ok {
+				t.Errorf("target %s missing after POST /-/reload", tc.expectedTarget)
+			}
+			// A failed reload keeps the config and the targets consistent
+			for alias, target := range safeTargets.C.Targets {
+				if _, ok := safeConfig.module(target.Module); !ok {
+					t.Errorf("target %s uses module %q missing from the active config", alias, target.Module)
+				}
+			}
+			expectedSuccess := boolToFloat64(tc.expectedStatus == http.StatusOK)
+			if value := testutil.ToFloat64(configReloadSuccess); value != expectedSuccess {
+				t.Errorf("configReloadSuccess = %v, want %v", value, expectedSuccess)
+			}
+		})
+	}
+}
+
+// TestReloadTargetsOnly tests that a targets file is loaded and reported as
+// a successful reload without a configuration file
+func TestReloadTargetsOnly(t *testing.T) {
+	origTargets := safeTargets.C
+	origConfigFile, origTargetsFile := *configFile, *targetsFile
+	defer func() {
+		safeTargets.set(origTargets)
+		*configFile, *targetsFile = origConfigFile, origTargetsFile
+	}()
+
+	configReloadSuccess.Set(0)
+	*configFile = ""
+	*targetsFile = writeTargets(t, "targets:\n  node: ws://127.0.0.1:8546\n")
+
+	if err := reload(); err != nil {
+		t.Fatalf("reload() unexpected error: %v", err)
+	}
+	if _, ok := safeTargets.target("node"); !ok {
+		t.Error("target node missing after reload")
+	}
+	if value := testutil.ToFloat64(configReloadSuccess); value != 1 {
+		t.Errorf("configReloadSuccess = %v, want 1", value)
+	}
+}
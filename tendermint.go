@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tendermintNewBlockQuery selects the NewBlock events of a Tendermint node.
+const tendermintNewBlockQuery = "tm.event='NewBlock'"
+
+// tendermintEvent is the result carried by a Tendermint subscription event.
+type tendermintEvent struct {
+	Query string `json:"query"`
+	Data  struct {
+		Type  string `json:"type"`
+		Value struct {
+			Block struct {
+				Header struct {
+					ChainID string    `json:"chain_id"`
+					Height  string    `json:"height"`
+					Time    time.Time `json:"time"`
+				} `json:"header"`
+			} `json:"block"`
+		} `json:"value"`
+	} `json:"data"`
+}
+
+// probeTendermint subscribes to NewBlock events on the /websocket endpoint of
+// a Tendermint/CometBFT node and waits for the first block.
+func probeTendermint(ctx context.Context, c *probeConn, module Module, result *probeResult) error {
+	client, err := newRPCClient(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	subscribeStart := time.Now()
+	if err := client.call("subscribe", map[string]string{"query": tendermintNewBlockQuery}, nil); err != nil {
+		return err
+	}
+	ackTime := time.Now()
+	result.setGauge("probe_tendermint_subscription_ack_duration_seconds", "Time until the NewBlock subscription was acknowledged", ackTime.Sub(subscribeStart).Seconds())
+
+	if module.Tendermint.NewBlockTimeout > 0 {
+		if err := client.setReadTimeout(module.Tendermint.NewBlockTimeout); err != nil {
+			return err
+		}
+	}
+
+	// Events reuse the ID of the subscribe request, so they are read
+	// directly rather than as notifications
+	var event tendermintEvent
+	for event.Query != tendermintNewBlockQuery {
+		message, err := client.read()
+		if err != nil {
+			return fmt.Errorf("no NewBlock event received: %w", err)
+		}
+		if message.Error != nil {
+			return message.Error
+		}
+		if len(message.Result) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(message.Result, &event); err != nil {
+			return fmt.Errorf("invalid NewBlock event: %w", err)
+		}
+	}
+	result.setGauge("probe_tendermint_first_block_duration_seconds", "Time from the subscription acknowledgement to the first NewBlock event", time.Since(ackTime).Seconds())
+
+	header := event.Data.Value.Block.Header
+	height, err := strconv.ParseUint(header.Height, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid block height %q: %w", header.Height, err)
+	}
+	result.setGauge("probe_tendermint_block_height", "Height of the first NewBlock event", float64(height))
+	result.setInfo("probe_tendermint_chain_info", "Chain ID of the first NewBlock event", prometheus.Labels{"chain_id": header.ChainID})
+	if !header.Time.IsZero() {
+		result.setGauge("probe_tendermint_block_age_seconds", "Age of the first NewBlock event based on its block time", time.Since(header.Time).Seconds())
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// tendermintNewBlockEvent builds a NewBlock event as sent for the subscribe
+// request with ID 1
+func tendermintNewBlockEvent(chainID string, height string, blockTime time.Time) interface{} {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"result": map[string]interface{}{
+			"query": tendermintNewBlockQuery,
+			"data": map[string]interface{}{
+				"type": "tendermint/event/NewBlock",
+				"value": map[string]interface{}{
+					"block": map[string]interface{}{
+						"header": map[string]interface{}{
+							"chain_id": chainID,
+							"height":   height,
+							"time":     blockTime.Format(time.RFC3339Nano),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// tendermintHandler acknowledges the NewBlock subscription and sends events
+func tendermintHandler(events ...interface{}) rpcHandler {
+	return func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+		if method != "subscribe" {
+			return nil, &rpcError{Code: -32601, Message: "method not found"}, nil
+		}
+		var query struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal(params, &query); err != nil || query.Query != tendermintNewBlockQuery {
+			return nil, &rpcError{Code: -32602, Message: "invalid query"}, nil
+		}
+		return map[string]interface{}{}, nil, events
+	}
+}
+
+// TestProbeTendermint tests the NewBlock subscription check
+func TestProbeTendermint(t *testing.T) {
+	blockTime := time.Now().Add(-6 * time.Second)
+
+	testCases := []struct {
+		name     string
+		handler  rpcHandler
+		expected bool
+	}{
+		{
+			name:     "NewBlock received",
+			handler:  tendermintHandler(tendermintNewBlockEvent("cosmoshub-4", "19000001", blockTime)),
+			expected: true,
+		},
+		{
+			name:     "No NewBlock event",
+			handler:  tendermintHandler(),
+			expected: false,
+		},
+		{
+			name:     "Invalid height",
+			handler:  tendermintHandler(tendermintNewBlockEvent("cosmoshub-4", "latest", blockTime)),
+			expected: false,
+		},
+		{
+			name: "Subscription rejected",
+			handler: func(method string, params json.RawMessage) (interface{}, *rpcError, []interface{}) {
+				return nil, &rpcError{Code: -32603, Message: "max_subscriptions_per_client reached"}, nil
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := newRPCServer(t, tc.handler)
+			module := Module{Prober: "tendermint", Timeout: 2 * time.Second, Tendermint: TendermintProbe{NewBlockTimeout: 200 * time.Millisecond}}
+
+			result := probeWebSocket(context.Background(), url, "", module)
+			if result.Success != tc.expected {
+				t.Fatalf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if !tc.expected {
+				return
+			}
+
+			if value, _ := resultGauge(t, result, "probe_tendermint_block_height"); value != 19000001 {
+				t.Errorf("probe_tendermint_block_height = %v, want 19000001", value)
+			}
+			if value, _ := resultGauge(t, result, "probe_tendermint_block_age_seconds"); value < 5 || value > 10 {
+				t.Errorf("probe_tendermint_block_age_seconds = %v, want about 6", value)
+			}
+			if value, ok := resultGauge(t, result, "probe_tendermint_first_block_duration_seconds"); !ok || value <= 0 {
+				t.Errorf("probe_tendermint_first_block_duration_seconds = %v, want > 0", value)
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(result.collectors()...)
+			expected := `
+# HELP probe_tendermint_chain_info Chain ID of the first NewBlock event
+# TYPE probe_tendermint_chain_info gauge
+probe_tendermint_chain_info{chain_id="cosmoshub-4"} 1
+`
+			if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "probe_tendermint_chain_info"); err != nil {
+				t.Errorf("unexpected probe_tendermint_chain_info: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tlsVersions maps the min_version and max_version settings to their values.
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// newTLSConfig builds the client TLS configuration, reading the CA bundle and
+// client certificate from disk.
+func (c TLSConfig) newTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+		MinVersion:         tlsVersions[c.MinVersion],
+		MaxVersion:         tlsVersions[c.MaxVersion],
+	}
+
+	if c.CAFile != "" {
+		bundle, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// validate checks the TLS settings, including that the files can be loaded.
+func (c TLSConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+	for _, version := range []string{c.MinVersion, c.MaxVersion} {
+		if _, ok := tlsVersions[version]; version != "" && !ok {
+			return fmt.Errorf("unknown TLS version %q", version)
+		}
+	}
+	if c.MinVersion != "" && c.MaxVersion != "" && tlsVersions[c.MinVersion] > tlsVersions[c.MaxVersion] {
+		return fmt.Errorf("min_version %s is above max_version %s", c.MinVersion, c.MaxVersion)
+	}
+	_, err := c.newTLSConfig()
+	return err
+}
+
+// setTLSMetrics exports the negotiated TLS parameters and the certificates
+// presented by a wss:// target, named like the blackbox exporter ones.
+func setTLSMetrics(state tls.ConnectionState, result *probeResult) {
+	result.setInfo("probe_tls_version_info", "Negotiated TLS version", prometheus.Labels{"version": tls.VersionName(state.Version)})
+	result.setInfo("probe_tls_cipher_info", "Negotiated TLS cipher suite", prometheus.Labels{"cipher": tls.CipherSuiteName(state.CipherSuite)})
+
+	if len(state.PeerCertificates) == 0 {
+		return
+	}
+
+	earliest := state.PeerCertificates[0].NotAfter
+	for _, cert := range state.PeerCertificates[1:] {
+		if cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	result.setGauge("probe_ssl_earliest_cert_expiry", "Returns earliest SSL cert expiry date", float64(earliest.Unix()))
+
+	// The chain that stays valid the longest is the one clients end up
+	// relying on. Without verification, e.g. with insecure_skip_verify, there
+	// is no chain to report.
+	if len(state.VerifiedChains) > 0 {
+		var last int64
+		for i, chain := range state.VerifiedChains {
+			chainExpiry := chain[0].NotAfter
+			for _, cert := range chain[1:] {
+				if cert.NotAfter.Before(chainExpiry) {
+					chainExpiry = cert.NotAfter
+				}
+			}
+			if i == 0 || chainExpiry.Unix() > last {
+				last = chainExpiry.Unix()
+			}
+		}
+		result.setGauge("probe_ssl_last_chain_expiry_timestamp_seconds", "Returns last SSL chain expiry in timestamp seconds", float64(last))
+	}
+
+	leaf := state.PeerCertificates[0]
+	fingerprint := sha256.Sum256(leaf.Raw)
+	var alternativeNames []string
+	alternativeNames = append(alternativeNames, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		alternativeNames = append(alternativeNames, ip.String())
+	}
+	alternativeNames = append(alternativeNames, leaf.EmailAddresses...)
+	for _, uri := range leaf.URIs {
+		alternativeNames = append(alternativeNames, uri.String())
+	}
+	result.setInfo("probe_ssl_last_chain_info", "Contains SSL leaf certificate information", prometheus.Labels{
+		"fingerprint_sha256": hex.EncodeToString(fingerprint[:]),
+		"subject":            leaf.Subject.String(),
+		"issuer":             leaf.Issuer.String(),
+		"subjectalternative": strings.Join(alternativeNames, ","),
+		"serialnumber":       leaf.SerialNumber.Text(16),
+	})
+}
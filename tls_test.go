@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTLSWebSocketServer starts a wss:// mock server that completes the
+// handshake and closes the connection
+func newTLSWebSocketServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestProbeWebSocketTLSMetrics tests the TLS metrics of wss:// targets
+func TestProbeWebSocketTLSMetrics(t *testing.T) {
+	server := newTLSWebSocketServer(t)
+	module := Module{Prober: "websocket", Timeout: 2 * time.Second}
+	module.WebSocket.TLSConfig.InsecureSkipVerify = true
+
+	result := probeWebSocket(context.Background(), "wss"+strings.TrimPrefix(server.URL, "https"), "", module)
+	if !result.Success {
+		t.Fatal("probeWebSocket().Success = false, want true")
+	}
+
+	expiry, ok := resultGauge(t, result, "probe_ssl_earliest_cert_expiry")
+	if !ok || expiry != float64(server.Certificate().NotAfter.Unix()) {
+		t.Errorf("probe_ssl_earliest_cert_expiry = %v (found %v), want %v", expiry, ok, server.Certificate().NotAfter.Unix())
+	}
+	// insecure_skip_verify leaves no verified chain
+	if _, ok := resultGauge(t, result, "probe_ssl_last_chain_expiry_timestamp_seconds"); ok {
+		t.Error("probe_ssl_last_chain_expiry_timestamp_seconds exported without a verified chain")
+	}
+
+	if version := resultLabels(t, result, "probe_tls_version_info")["version"]; !strings.HasPrefix(version, "TLS 1.") {
+		t.Errorf("probe_tls_version_info version = %q, want TLS 1.x", version)
+	}
+	if cipher := resultLabels(t, result, "probe_tls_cipher_info")["cipher"]; !strings.HasPrefix(cipher, "TLS_") {
+		t.Errorf("probe_tls_cipher_info cipher = %q, want a cipher suite name", cipher)
+	}
+
+	info := resultLabels(t, result, "probe_ssl_last_chain_info")
+	if !strings.Contains(info["subjectalternative"], "example.com") || !strings.Contains(info["subjectalternative"], "127.0.0.1") {
+		t.Errorf("probe_ssl_last_chain_info subjectalternative = %q, want example.com and 127.0.0.1", info["subjectalternative"])
+	}
+	if !strings.Contains(info["subject"], "Acme Co") {
+		t.Errorf("probe_ssl_last_chain_info subject = %q, want Acme Co", info["subject"])
+	}
+	if len(info["fingerprint_sha256"]) != 64 {
+		t.Errorf("probe_ssl_last_chain_info fingerprint_sha256 = %q, want a SHA-256 hex digest", info["fingerprint_sha256"])
+	}
+}
+
+// TestProbeWebSocketPlainNoTLSMetrics tests that ws:// targets export no TLS metrics
+func TestProbeWebSocketPlainNoTLSMetrics(t *testing.T) {
+	server := newDelayedServer(t, 0)
+	result := probeWebSocket(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), "", Module{Prober: "websocket"})
+	if !result.Success {
+		t.Fatal("probeWebSocket().Success = false, want true")
+	}
+	for _, name := range []string{"probe_ssl_earliest_cert_expiry", "probe_tls_version_info", "probe_ssl_last_chain_info"} {
+		if _, ok := resultGauge(t, result, name); ok {
+			t.Errorf("%s exported for a ws:// target", name)
+		}
+	}
+}
+
+// TestSetTLSMetricsChains tests that the last chain expiry is the longest
+// lived of the verified chains, each expiring with its earliest certificate
+func TestSetTLSMetricsChains(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	cert := func(notAfter time.Time) *x509.Certificate {
+		return &x509.Certificate{NotAfter: notAfter, SerialNumber: big.NewInt(1)}
+	}
+	leaf := cert(now.Add(90 * 24 * time.Hour))
+	shortIntermediate := cert(now.Add(30 * 24 * time.Hour))
+	longIntermediate := cert(now.Add(365 * 24 * time.Hour))
+
+	state := tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		PeerCertificates: []*x509.Certificate{leaf, shortIntermediate},
+		VerifiedChains: [][]*x509.Certificate{
+			{leaf, shortIntermediate},
+			{leaf, longIntermediate},
+		},
+	}
+	var result probeResult
+	setTLSMetrics(state, &result)
+
+	if value, _ := resultGauge(t, result, "probe_ssl_earliest_cert_expiry"); value != float64(shortIntermediate.NotAfter.Unix()) {
+		t.Errorf("probe_ssl_earliest_cert_expiry = %v, want %v", value, shortIntermediate.NotAfter.Unix())
+	}
+	if value, _ := resultGauge(t, result, "probe_ssl_last_chain_expiry_timestamp_seconds"); value != float64(leaf.NotAfter.Unix()) {
+		t.Errorf("probe_ssl_last_chain_expiry_timestamp_seconds = %v, want %v", value, leaf.NotAfter.Unix())
+	}
+	if version := resultLabels(t, result, "probe_tls_version_info")["version"]; version != "TLS 1.3" {
+		t.Errorf("probe_tls_version_info version = %q, want TLS 1.3", version)
+	}
+	if cipher := resultLabels(t, result, "probe_tls_cipher_info")["cipher"]; cipher != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("probe_tls_cipher_info cipher = %q, want TLS_AES_128_GCM_SHA256", cipher)
+	}
+}
+
+// testCA is a throwaway certificate authority for the mutual TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse CA certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// writeClientCert issues a client certificate and writes it and its key to
+// cert.pem and key.pem in dir
+func (ca *testCA) writeClientCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate client key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "exporter"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal client key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+// writePEM writes a single PEM block to path
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// TestProbeWebSocketTLSConfig tests the module TLS settings against servers
+// with and without client certificate authentication
+func TestProbeWebSocketTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	clientCA := newTestCA(t)
+	otherCA := newTestCA(t)
+
+	server := newTLSWebSocketServer(t)
+	serverCAFile := filepath.Join(dir, "server-ca.pem")
+	writePEM(t, serverCAFile, "CERTIFICATE", server.Certificate().Raw)
+
+	upgrader := websocket.Upgrader{}
+	mtlsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.cert)
+	mtlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mtlsServer.StartTLS()
+	defer mtlsServer.Close()
+
+	trustedDir, untrustedDir := filepath.Join(dir, "trusted"), filepath.Join(dir, "untrusted")
+	for _, d := range []string{trustedDir, untrustedDir} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			t.Fatalf("Failed to create %s: %v", d, err)
+		}
+	}
+	trustedCert, trustedKey := clientCA.writeClientCert(t, trustedDir)
+	untrustedCert, untrustedKey := otherCA.writeClientCert(t, untrustedDir)
+
+	target := "wss" + strings.TrimPrefix(server.URL, "https")
+	mtlsTarget := "wss" + strings.TrimPrefix(mtlsServer.URL, "https")
+
+	testCases := []struct {
+		name            string
+		target          string
+		tlsConfig       TLSConfig
+		expected        bool
+		expectedVersion string
+	}{
+		{
+			name:      "Unknown CA",
+			target:    target,
+			tlsConfig: TLSConfig{},
+			expected:  false,
+		},
+		{
+			name:      "CA file",
+			target:    target,
+			tlsConfig: TLSConfig{CAFile: serverCAFile},
+			expected:  true,
+		},
+		{
+			name:      "Server name mismatch",
+			target:    target,
+			tlsConfig: TLSConfig{CAFile: serverCAFile, ServerName: "wrong.example.org"},
+			expected:  false,
+		},
+		{
+			name:      "Server name override",
+			target:    target,
+			tlsConfig: TLSConfig{CAFile: serverCAFile, ServerName: "example.com"},
+			expected:  true,
+		},
+		{
+			name:            "Maximum version",
+			target:          target,
+			tlsConfig:       TLSConfig{CAFile: serverCAFile, MaxVersion: "TLS12"},
+			expected:        true,
+			expectedVersion: "TLS 1.2",
+		},
+		{
+			name:      "Missing client certificate",
+			target:    mtlsTarget,
+			tlsConfig: TLSConfig{InsecureSkipVerify: true},
+			expected:  false,
+		},
+		{
+			name:      "Untrusted client certificate",
+			target:    mtlsTarget,
+			tlsConfig: TLSConfig{InsecureSkipVerify: true, CertFile: untrustedCert, KeyFile: untrustedKey},
+			expected:  false,
+		},
+		{
+			name:      "Trusted client certificate",
+			target:    mtlsTarget,
+			tlsConfig: TLSConfig{InsecureSkipVerify: true, CertFile: trustedCert, KeyFile: trustedKey},
+			expected:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module := Module{Prober: "websocket", Timeout: 2 * time.Second}
+			module.WebSocket.TLSConfig = tc.tlsConfig
+			result := probeWebSocket(context.Background(), tc.target, "", module)
+			if result.Success != tc.expected {
+				t.Fatalf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if tc.expectedVersion != "" {
+				if version := resultLabels(t, result, "probe_tls_version_info")["version"]; version != tc.expectedVersion {
+					t.Errorf("probe_tls_version_info version = %q, want %q", version, tc.expectedVersion)
+				}
+			}
+			if tc.expected && tc.tlsConfig.CAFile != "" {
+				if _, ok := resultGauge(t, result, "probe_ssl_last_chain_expiry_timestamp_seconds"); !ok {
+					t.Error("probe_ssl_last_chain_expiry_timestamp_seconds not exported for a verified chain")
+				}
+			}
+		})
+	}
+
+	// Rotating the client certificate on disk takes effect on the next probe
+	t.Run("Rotated client certificate", func(t *testing.T) {
+		rotatingCert, rotatingKey := otherCA.writeClientCert(t, dir)
+		module := Module{Prober: "websocket", Timeout: 2 * time.Second}
+		module.WebSocket.TLSConfig = TLSConfig{InsecureSkipVerify: true, CertFile: rotatingCert, KeyFile: rotatingKey}
+		if result := probeWebSocket(context.Background(), mtlsTarget, "", module); result.Success {
+			t.Fatal("probeWebSocket() with untrusted certificate succeeded")
+		}
+		clientCA.writeClientCert(t, dir)
+		if result := probeWebSocket(context.Background(), mtlsTarget, "", module); !result.Success {
+			t.Error("probeWebSocket() after rotation to a trusted certificate failed")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// connectionPhases are the phases reported in
+// probe_websocket_phase_duration_seconds, in the order they happen.
+var connectionPhases = []string{"resolve", "connect", "tls", "upgrade"}
+
+// phaseTracer times the connection phases through the httptrace hooks called
+// by the WebSocket dialer and net.Dialer. Hooks can fire from several
+// goroutines when multiple addresses are dialed, hence the mutex.
+type phaseTracer struct {
+	mu        sync.Mutex
+	starts    map[string]time.Time
+	durations map[string]time.Duration
+}
+
+func newPhaseTracer() *phaseTracer {
+	return &phaseTracer{
+		starts:    make(map[string]time.Time),
+		durations: make(map[string]time.Duration),
+	}
+}
+
+// start marks the beginning of a phase. Only the first call counts, so that
+// parallel connection attempts are timed from the first one.
+func (t *phaseTracer) start(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.starts[phase]; !ok {
+		t.starts[phase] = time.Now()
+	}
+}
+
+// restart marks the beginning of a phase, overriding an earlier start.
+func (t *phaseTracer) restart(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.starts[phase] = time.Now()
+}
+
+// done marks the end of a phase that was started.
+func (t *phaseTracer) done(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if start, ok := t.starts[phase]; ok {
+		t.durations[phase] = time.Since(start)
+	}
+}
+
+// clientTrace returns the hooks feeding the tracer. The upgrade phase starts
+// once the connection is usable, which is after the TLS handshake for wss://
+// targets, and must be ended by the caller when the dial returns.
+func (t *phaseTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.start("resolve") },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.done("resolve") },
+		ConnectStart: func(string, string) {
+			t.start("connect")
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.done("connect")
+			}
+		},
+		GotConn:           func(httptrace.GotConnInfo) { t.start("upgrade") },
+		TLSHandshakeStart: func() { t.start("tls") },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.done("tls")
+			t.restart("upgrade")
+		},
+	}
+}
+
+// report adds the duration of every phase to the result. Phases that did not
+// happen, e.g. resolving an IP address, are reported as 0.
+func (t *phaseTracer) report(result *probeResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, phase := range connectionPhases {
+		result.setLabeledGauge("probe_websocket_phase_duration_seconds", "Duration of the WebSocket connection phases", prometheus.Labels{"phase": phase}, t.durations[phase].Seconds())
+	}
+}
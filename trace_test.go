@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestProbeWebSocketPhases tests the per-phase timing of the connection
+func TestProbeWebSocketPhases(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	upgrader := websocket.Upgrader{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	module := Module{Prober: "websocket", Timeout: 2 * time.Second}
+	module.WebSocket.TLSConfig.InsecureSkipVerify = true
+
+	testCases := []struct {
+		name         string
+		target       string
+		expectedUp   bool
+		expectedZero []string
+		expectedSet  []string
+	}{
+		{
+			name:         "IP address",
+			target:       "ws" + strings.TrimPrefix(plain.URL, "http"),
+			expectedUp:   true,
+			expectedZero: []string{"resolve", "tls"},
+			expectedSet:  []string{"connect", "upgrade"},
+		},
+		{
+			name:        "Host name over TLS",
+			target:      "wss" + strings.Replace(strings.TrimPrefix(secure.URL, "https"), "127.0.0.1", "localhost", 1),
+			expectedUp:  true,
+			expectedSet: []string{"resolve", "connect", "tls", "upgrade"},
+		},
+		{
+			name:         "Connection refused",
+			target:       "ws://127.0.0.1:1",
+			expectedZero: []string{"resolve", "connect", "tls", "upgrade"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := probeWebSocket(context.Background(), tc.target, "", module)
+			if result.Up != tc.expectedUp {
+				t.Fatalf("probeWebSocket().Up = %v, want %v", result.Up, tc.expectedUp)
+			}
+
+			durations := labeledGauges(t, result, "probe_websocket_phase_duration_seconds", "phase")
+			if len(durations) != len(connectionPhases) {
+				t.Fatalf("got phases %v, want all of %v", durations, connectionPhases)
+			}
+			for _, phase := range tc.expectedZero {
+				if durations[phase] != 0 {
+					t.Errorf("phase %s = %v, want 0", phase, durations[phase])
+				}
+			}
+			for _, phase := range tc.expectedSet {
+				if durations[phase] <= 0 {
+					t.Errorf("phase %s = %v, want > 0", phase, durations[phase])
+				}
+			}
+			if tc.expectedUp && durations["upgrade"] < delay.Seconds() {
+				t.Errorf("phase upgrade = %v, want at least the handshake delay %v", durations["upgrade"], delay.Seconds())
+			}
+		})
+	}
+}
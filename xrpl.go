@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rippleEpoch is the start of the XRP Ledger epoch, 2000-01-01T00:00:00Z,
+// in Unix seconds.
+const rippleEpoch = 946684800
+
+// xrplServerStates are the server states reported by rippled, exported as
+// one series each so that the current state can be matched on.
+var xrplServerStates = []string{"disconnected", "connected", "syncing", "tracking", "full", "validating", "proposing"}
+
+// xrplMessage is any message received from rippled: a command response or
+// a stream message.
+type xrplMessage struct {
+	ID           *uint64         `json:"id,omitempty"`
+	Type         string          `json:"type"`
+	Status       string          `json:"status,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	ErrorMessage string          `json:"error_message,omitempty"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	LedgerIndex  uint64          `json:"ledger_index,omitempty"`
+	LedgerTime   int64           `json:"ledger_time,omitempty"`
+}
+
+// xrplServerInfo is the part of the server_info result the prober looks at.
+type xrplServerInfo struct {
+	Info struct {
+		ServerState     string `json:"server_state"`
+		ValidatedLedger struct {
+			Seq uint64 `json:"seq"`
+		} `json:"validated_ledger"`
+	} `json:"info"`
+}
+
+// xrplError is a failed command response returned by rippled.
+type xrplError struct {
+	Command string
+	Code    string
+	Message string
+}
+
+func (e *xrplError) Error() string {
+	return fmt.Sprintf("%s failed: %s %s", e.Command, e.Code, e.Message)
+}
+
+// xrplClient sends rippled WebSocket API commands over a connection.
+type xrplClient struct {
+	conn   *probeConn
+	nextID uint64
+	// ledgers holds ledgerClosed messages received while waiting for a
+	// command response.
+	ledgers []xrplMessage
+}
+
+// command sends a command and decodes the result of its response.
+func (c *xrplClient) command(command string, fields map[string]interface{}, result interface{}) error {
+	c.nextID++
+	request := map[string]interface{}{"id": c.nextID, "command": command}
+	for name, value := range fields {
+		request[name] = value
+	}
+	if err := c.conn.WriteJSON(request); err != nil {
+		return fmt.Errorf("error sending %s command: %w", command, err)
+	}
+
+	for {
+		var message xrplMessage
+		if err := c.conn.ReadJSON(&message); err != nil {
+			return fmt.Errorf("error reading %s response: %w", command, err)
+		}
+		if message.Type == "ledgerClosed" {
+			c.ledgers = append(c.ledgers, message)
+			continue
+		}
+		if message.ID == nil || *message.ID != c.nextID {
+			continue
+		}
+		if message.Status != "success" {
+			return &xrplError{Command: command, Code: message.Error, Message: message.ErrorMessage}
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(message.Result, result); err != nil {
+			return fmt.Errorf("error decoding %s result: %w", command, err)
+		}
+		return nil
+	}
+}
+
+// nextLedger waits for the next ledgerClosed stream message.
+func (c *xrplClient) nextLedger() (xrplMessage, error) {
+	if len(c.ledgers) > 0 {
+		message := c.ledgers[0]
+		c.ledgers = c.ledgers[1:]
+		return message, nil
+	}
+	for {
+		var message xrplMessage
+		if err := c.conn.ReadJSON(&message); err != nil {
+			return message, err
+		}
+		if message.Type == "ledgerClosed" {
+			return message, nil
+		}
+	}
+}
+
+// probeXRPL checks that a rippled server is serving validated ledgers by
+// calling server_info and waiting for the first ledger of the ledger stream.
+func probeXRPL(ctx context.Context, c *probeConn, module Module, result *probeResult) error {
+	settings := module.XRPL
+	deadline, _ := ctx.Deadline()
+	if err := c.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+	if err := c.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	client := &xrplClient{conn: c}
+
+	var serverInfo xrplServerInfo
+	if err := client.command("server_info", nil, &serverInfo); err != nil {
+		return err
+	}
+	state := serverInfo.Info.ServerState
+	for _, known := range xrplServerStates {
+		result.setLabeledGauge("probe_xrpl_server_state", "Server state reported by server_info", prometheus.Labels{"state": known}, boolToFloat64(state == known))
+	}
+	result.setGauge("probe_xrpl_validated_ledger_index", "Index of the latest validated ledger", float64(serverInfo.Info.ValidatedLedger.Seq))
+	// A server in the wrong state fails without waiting for a ledger
+	if len(settings.ValidServerStates) > 0 && !slices.Contains(settings.ValidServerStates, state) {
+		return assertionf("server state is %q, expected one of %v", state, settings.ValidServerStates)
+	}
+
+	subscribeStart := time.Now()
+	if err := client.command("subscribe", map[string]interface{}{"streams": []string{"ledger"}}, nil); err != nil {
+		return err
+	}
+	ackTime := time.Now()
+	result.setGauge("probe_xrpl_subscription_ack_duration_seconds", "Time until the ledger stream subscription was acknowledged", ackTime.Sub(subscribeStart).Seconds())
+
+	if settings.LedgerTimeout > 0 {
+		ledgerDeadline := time.Now().Add(settings.LedgerTimeout)
+		if deadline.IsZero() || ledgerDeadline.Before(deadline) {
+			if err := c.SetReadDeadline(ledgerDeadline); err != nil {
+				return err
+			}
+		}
+	}
+
+	ledger, err := client.nextLedger()
+	if err != nil {
+		return fmt.Errorf("no ledgerClosed message received: %w", err)
+	}
+	result.setGauge("probe_xrpl_first_ledger_duration_seconds", "Time from the subscription acknowledgement to the first ledgerClosed message", time.Since(ackTime).Seconds())
+	result.setGauge("probe_xrpl_ledger_index", "Index of the first ledger received on the ledger stream", float64(ledger.LedgerIndex))
+	closeTime := time.Unix(ledger.LedgerTime+rippleEpoch, 0)
+	result.setGauge("probe_xrpl_ledger_close_age_seconds", "Age of the first ledger received on the ledger stream based on its close time", time.Since(closeTime).Seconds())
+
+	return nil
+}
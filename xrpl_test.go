@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newXRPLServer starts a mock rippled server reporting serverState and
+// sending ledgerClosed messages once the ledger stream is subscribed to
+func newXRPLServer(t *testing.T, serverState string, ledgers ...map[string]interface{}) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Failed to upgrade connection: %v", err)
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				t.Logf("Failed to close connection: %v", err)
+			}
+		}()
+
+		for {
+			var request struct {
+				ID      uint64   `json:"id"`
+				Command string   `json:"command"`
+				Streams []string `json:"streams"`
+			}
+			if err := conn.ReadJSON(&request); err != nil {
+				return
+			}
+
+			response := map[string]interface{}{"id": request.ID, "type": "response", "status": "success"}
+			switch request.Command {
+			case "server_info":
+				response["result"] = map[string]interface{}{
+					"info": map[string]interface{}{
+						"server_state":     serverState,
+						"validated_ledger": map[string]interface{}{"seq": 88000000, "age": 2},
+					},
+				}
+			case "subscribe":
+				response["result"] = map[string]interface{}{"ledger_index": 88000000}
+			default:
+				response = map[string]interface{}{"id": request.ID, "type": "response", "status": "error", "error": "unknownCmd"}
+			}
+			if err := conn.WriteJSON(response); err != nil {
+				return
+			}
+
+			if request.Command == "subscribe" {
+				for _, ledger := range ledgers {
+					if err := conn.WriteJSON(ledger); err != nil {
+						return
+					}
+				}
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// xrplLedgerClosed builds a ledgerClosed stream message
+func xrplLedgerClosed(index uint64, closeTime time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"type":         "ledgerClosed",
+		"ledger_index": index,
+		"ledger_time":  closeTime.Unix() - rippleEpoch,
+	}
+}
+
+// TestProbeXRPL tests the server_info and ledger stream checks
+func TestProbeXRPL(t *testing.T) {
+	closeTime := time.Now().Add(-4 * time.Second)
+
+	testCases := []struct {
+		name     string
+		url      string
+		settings XRPLProbe
+		expected bool
+	}{
+		{
+			name:     "Full server",
+			url:      newXRPLServer(t, "full", xrplLedgerClosed(88000001, closeTime)),
+			settings: XRPLProbe{ValidServerStates: []string{"full", "validating", "proposing"}},
+			expected: true,
+		},
+		{
+			name:     "Syncing server rejected",
+			url:      newXRPLServer(t, "syncing", xrplLedgerClosed(88000001, closeTime)),
+			settings: XRPLProbe{ValidServerStates: []string{"full"}},
+			expected: false,
+		},
+		{
+			name:     "Syncing server allowed",
+			url:      newXRPLServer(t, "syncing", xrplLedgerClosed(88000001, closeTime)),
+			expected: true,
+		},
+		{
+			name:     "No ledger closed",
+			url:      newXRPLServer(t, "full"),
+			settings: XRPLProbe{LedgerTimeout: 200 * time.Millisecond},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module := Module{Prober: "xrpl", Timeout: 2 * time.Second, XRPL: tc.settings}
+
+			result := probeWebSocket(context.Background(), tc.url, "", module)
+			if result.Success != tc.expected {
+				t.Fatalf("probeWebSocket().Success = %v, want %v", result.Success, tc.expected)
+			}
+			if !tc.expected {
+				// A rejected server state fails before subscribing
+				if _, ok := resultGauge(t, result, "probe_xrpl_subscription_ack_duration_seconds"); ok && result.FailedDueTo == "assertion" {
+					t.Error("probe_xrpl_subscription_ack_duration_seconds exported for a rejected server state")
+				}
+				return
+			}
+
+			if value, _ := resultGauge(t, result, "probe_xrpl_validated_ledger_index"); value != 88000000 {
+				t.Errorf("probe_xrpl_validated_ledger_index = %v, want 88000000", value)
+			}
+			if value, _ := resultGauge(t, result, "probe_xrpl_ledger_index"); value != 88000001 {
+				t.Errorf("probe_xrpl_ledger_index = %v, want 88000001", value)
+			}
+			if value, _ := resultGauge(t, result, "probe_xrpl_ledger_close_age_seconds"); value < 3 || value > 10 {
+				t.Errorf("probe_xrpl_ledger_close_age_seconds = %v, want about 4", value)
+			}
+			if value, ok := resultGauge(t, result, "probe_xrpl_first_ledger_duration_seconds"); !ok || value <= 0 {
+				t.Errorf("probe_xrpl_first_ledger_duration_seconds = %v, want > 0", value)
+			}
+		})
+	}
+}
+
+// TestProbeXRPLServerState tests the enum-style server state metric
+func TestProbeXRPLServerState(t *testing.T) {
+	url := newXRPLServer(t, "tracking", xrplLedgerClosed(88000001, time.Now()))
+	result := probeWebSocket(context.Background(), url, "", Module{Prober: "xrpl", Timeout: 2 * time.Second})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(result.collectors()...)
+	expected := `
+# HELP probe_xrpl_server_state Server state reported by server_info
+# TYPE probe_xrpl_server_state gauge
+probe_xrpl_server_state{state="connected"} 0
+probe_xrpl_server_state{state="disconnected"} 0
+probe_xrpl_server_state{state="full"} 0
+probe_xrpl_server_state{state="proposing"} 0
+probe_xrpl_server_state{state="syncing"} 0
+probe_xrpl_server_state{state="tracking"} 1
+probe_xrpl_server_state{state="validating"} 0
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "probe_xrpl_server_state"); err != nil {
+		t.Errorf("unexpected probe_xrpl_server_state: %v", err)
+	}
+}